@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"altia-cafe-backend/internal/models"
 
@@ -38,7 +39,141 @@ func Connect() error {
 	return nil
 }
 
+// moneyColumns lists every column holding a models.Money value.
+var moneyColumns = []struct{ table, column string }{
+	{"menu_items", "price"},
+	{"order_items", "price"},
+	{"order_items", "subtotal"},
+	{"orders", "total"},
+	{"payments", "amount"},
+	{"customers", "credit_balance"},
+}
+
+// migrateMoneyColumns converts legacy floating-point money columns, which
+// held major units, into bigint minor units. It must run before AutoMigrate,
+// which would otherwise change the column type without rescaling the data.
+func migrateMoneyColumns(tx *gorm.DB) error {
+	for _, mc := range moneyColumns {
+		var dataType string
+		err := tx.Raw(`SELECT data_type FROM information_schema.columns
+			WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?`,
+			mc.table, mc.column).Scan(&dataType).Error
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s.%s: %w", mc.table, mc.column, err)
+		}
+		if dataType == "" || dataType == "bigint" {
+			continue
+		}
+
+		stmt := fmt.Sprintf(`ALTER TABLE %q ALTER COLUMN %q TYPE bigint USING ROUND(%q * %d)::bigint`,
+			mc.table, mc.column, mc.column, models.MinorUnits)
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to convert %s.%s to minor units: %w", mc.table, mc.column, err)
+		}
+		log.Printf("Converted %s.%s from %s to minor units", mc.table, mc.column, dataType)
+	}
+	return nil
+}
+
+// dataMigration records a one-time data migration that has been applied.
+type dataMigration struct {
+	Name      string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+// runOnce applies a one-time data migration in a transaction and records it
+// under name. A migration already recorded is skipped. Instances starting
+// together wait for each other, so only the first applies it.
+func runOnce(name string, migrate func(tx *gorm.DB) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "data_migration:"+name).Error; err != nil {
+				return err
+			}
+		}
+		var count int64
+		if err := tx.Model(&dataMigration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := migrate(tx); err != nil {
+			return err
+		}
+		return tx.Create(&dataMigration{Name: name, AppliedAt: time.Now()}).Error
+	})
+}
+
+// ledgerDrift is a customer whose stored credit balance differs from the sum
+// of their ledger entries.
+type ledgerDrift struct {
+	ID            uint
+	TenantID      *uint
+	CreatedAt     time.Time
+	CreditBalance models.Money
+	Posted        models.Money
+}
+
+// driftedBalances returns every live customer whose balance differs from
+// their ledger.
+func driftedBalances(tx *gorm.DB) ([]ledgerDrift, error) {
+	var drifted []ledgerDrift
+	err := tx.Raw(`SELECT c.id, c.tenant_id, c.created_at, c.credit_balance, COALESCE(SUM(l.amount), 0) AS posted
+		FROM customers c LEFT JOIN ledger_entries l ON l.customer_id = c.id
+		WHERE c.deleted_at IS NULL
+		GROUP BY c.id, c.tenant_id, c.created_at, c.credit_balance
+		HAVING c.credit_balance <> COALESCE(SUM(l.amount), 0)`).Scan(&drifted).Error
+	return drifted, err
+}
+
+// carryForwardBalances gives every customer whose balance predates the
+// ledger an opening entry for it, dated when the customer was created so
+// statements and backfilled invoices start from it. It runs once.
+func carryForwardBalances(tx *gorm.DB) error {
+	drifted, err := driftedBalances(tx)
+	if err != nil {
+		return fmt.Errorf("failed to carry balances forward: %w", err)
+	}
+
+	for _, d := range drifted {
+		entry := models.LedgerEntry{
+			CreatedAt:  d.CreatedAt,
+			TenantID:   d.TenantID,
+			CustomerID: d.ID,
+			Type:       models.LedgerAdjustment,
+			Amount:     d.CreditBalance.Sub(d.Posted),
+			Notes:      "Balance carried forward",
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return fmt.Errorf("failed to carry balances forward: %w", err)
+		}
+	}
+	if len(drifted) > 0 {
+		log.Printf("Carried balances forward to the ledger for %d customers", len(drifted))
+	}
+	return nil
+}
+
+// checkLedger logs every customer whose balance has drifted from their
+// ledger. Drift means a balance changed without a ledger entry, so it is
+// reported for investigation rather than corrected.
+func checkLedger() error {
+	drifted, err := driftedBalances(DB)
+	if err != nil {
+		return fmt.Errorf("failed to check ledger: %w", err)
+	}
+	for _, d := range drifted {
+		log.Printf("WARNING: customer %d has a credit balance of %s but ledger entries of %s", d.ID, d.CreditBalance, d.Posted)
+	}
+	return nil
+}
+
 func Migrate() error {
+	if err := DB.Transaction(migrateMoneyColumns); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
 	err := DB.AutoMigrate(
 		&models.Cafe{},
 		&models.User{},
@@ -48,16 +183,160 @@ func Migrate() error {
 		&models.Order{},
 		&models.OrderItem{},
 		&models.Payment{},
+		&models.LedgerEntry{},
+		&models.Invitation{},
+		&models.Session{},
+		&models.Terminal{},
+		&models.AuditEvent{},
+		&models.Reservation{},
+		&models.BillGroup{},
+		&models.TaxRate{},
+		&models.Invoice{},
+		&models.ZReport{},
+		&models.CashSession{},
+		&models.CashMovement{},
+		&dataMigration{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("migration failed: %w", err)
 	}
 
+	// Phones are only unique per cafe and when set, so several walk-in guests
+	// can be on file without one; idx_customers_tenant_phone replaces these
+	for _, index := range []string{"idx_customers_phone", "idx_customers_phone_set"} {
+		if err := DB.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
+	// Orders priced before the breakdown existed had no discount or tax, so
+	// their subtotal is their total
+	if err := runOnce("backfill_order_subtotals", func(tx *gorm.DB) error {
+		return tx.Exec("UPDATE orders SET subtotal = total WHERE subtotal = 0 AND total <> 0").Error
+	}); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	// Orders paid before paid amounts were tracked. Once tracked, a refund
+	// can bring an order back to nothing paid, so this runs once.
+	if err := runOnce("backfill_order_payments", func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE orders SET amount_paid = p.total
+			FROM (SELECT order_id, SUM(amount) AS total FROM payments
+				WHERE order_id IS NOT NULL AND deleted_at IS NULL GROUP BY order_id) p
+			WHERE p.order_id = orders.id AND orders.amount_paid = 0 AND orders.paid_at IS NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE orders SET paid_at = updated_at WHERE paid_at IS NULL AND amount_paid > 0 AND amount_paid >= total").Error
+	}); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	// Balances from before the ledger existed are carried forward once,
+	// before the invoices below read them
+	if err := runOnce("carry_forward_balances", carryForwardBalances); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	// Invoices used to be numbered when first printed; number the bills and
+	// payments never printed after the existing invoices, oldest first, with
+	// the balance the ledger shows at the time. Later invoices are numbered
+	// as they are issued, so this runs once.
+	if err := runOnce("backfill_invoices", func(tx *gorm.DB) error {
+		return tx.Exec(`INSERT INTO invoices (created_at, tenant_id, number, order_id, payment_id, balance)
+			SELECT NOW(), d.tenant_id,
+				COALESCE((SELECT MAX(i.number) FROM invoices i WHERE i.tenant_id IS NOT DISTINCT FROM d.tenant_id), 0)
+					+ ROW_NUMBER() OVER (PARTITION BY d.tenant_id ORDER BY d.issued_at, d.payment_id NULLS FIRST, d.order_id),
+				d.order_id, d.payment_id,
+				(SELECT COALESCE(SUM(l.amount), 0) FROM ledger_entries l
+					WHERE l.customer_id = d.customer_id AND l.created_at <= d.issued_at)
+			FROM (
+				SELECT o.tenant_id, o.customer_id, o.billed_at AS issued_at, o.id AS order_id, NULL::bigint AS payment_id
+				FROM orders o
+				WHERE o.billed_at IS NOT NULL AND o.deleted_at IS NULL
+					AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.order_id = o.id)
+				UNION ALL
+				SELECT p.tenant_id, p.customer_id, p.created_at, NULL, p.id
+				FROM payments p
+				WHERE p.deleted_at IS NULL
+					AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.payment_id = p.id)
+			) d`).Error
+	}); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	// Invoices issued before they named whose balance they record were
+	// issued with the balance of the order's or payment's customer
+	if err := runOnce("invoice_customers", func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE invoices SET customer_id = o.customer_id FROM orders o
+			WHERE invoices.order_id = o.id AND invoices.customer_id IS NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE invoices SET customer_id = p.customer_id FROM payments p
+			WHERE invoices.payment_id = p.id AND invoices.customer_id IS NULL`).Error
+	}); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	if err := checkLedger(); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
 	log.Println("Database migration completed")
 	return nil
 }
 
+// tenantTables lists every table with a tenant_id column.
+var tenantTables = []string{
+	"users",
+	"customers",
+	"tables",
+	"menu_items",
+	"orders",
+	"order_items",
+	"payments",
+	"ledger_entries",
+	"audit_events",
+	"reservations",
+	"bill_groups",
+	"tax_rates",
+	"invoices",
+	"z_reports",
+	"cash_sessions",
+	"cash_movements",
+}
+
+// AssignOrphans moves every row without a tenant to the given cafe, so data
+// created before multi-tenancy stays visible under strict tenancy. Platform
+// superadmins are left unassigned. It returns the number of rows updated per
+// table.
+func AssignOrphans(cafeID uint) (map[string]int64, error) {
+	counts := map[string]int64{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var cafe models.Cafe
+		if err := tx.First(&cafe, cafeID).Error; err != nil {
+			return fmt.Errorf("cafe %d not found: %w", cafeID, err)
+		}
+
+		for _, table := range tenantTables {
+			query := tx.Table(table).Where("tenant_id IS NULL")
+			if table == "users" {
+				query = query.Where("role <> ?", models.RoleSuperAdmin)
+			}
+			result := query.Update("tenant_id", cafe.ID)
+			if result.Error != nil {
+				return fmt.Errorf("failed to assign %s: %w", table, result.Error)
+			}
+			counts[table] = result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
 func Seed() error {
 	// Check if admin already exists
 	var count int64
@@ -88,11 +367,27 @@ func Seed() error {
 	// Create sample customers
 	customers := []models.Customer{
 		{Name: "Ram Sharma", Phone: "9841234567", CreditBalance: 0},
-		{Name: "Sita Thapa", Phone: "9851234567", CreditBalance: 150.50},
+		{Name: "Sita Thapa", Phone: "9851234567", CreditBalance: 15050},
 		{Name: "Hari Gurung", Phone: "9861234567", CreditBalance: 0},
 	}
 	DB.Create(&customers)
 
+	// Post the sample balances as opening ledger entries
+	for _, customer := range customers {
+		if customer.CreditBalance == 0 {
+			continue
+		}
+		entry := models.LedgerEntry{
+			CustomerID: customer.ID,
+			Type:       models.LedgerAdjustment,
+			Amount:     customer.CreditBalance,
+			Notes:      "Opening balance",
+		}
+		if err := DB.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
+
 	// Create 5 tables
 	tables := []models.Table{
 		{Name: "Table 1", PositionX: 50, PositionY: 50, Width: 100, Height: 100, Status: models.TableFree},
@@ -105,14 +400,14 @@ func Seed() error {
 
 	// Create menu items
 	menuItems := []models.MenuItem{
-		{Name: "Chiyaa (Tea)", Category: "Beverages", Price: 20, Available: true, Description: "Traditional Nepali tea"},
-		{Name: "Coffee", Category: "Beverages", Price: 50, Available: true, Description: "Hot coffee"},
-		{Name: "Cold Drink", Category: "Beverages", Price: 40, Available: true, Description: "Soft drinks"},
-		{Name: "Ice", Category: "Beverages", Price: 10, Available: true, Description: "Ice cubes"},
-		{Name: "Samosa", Category: "Snacks", Price: 15, Available: true, Description: "Crispy vegetable samosa"},
-		{Name: "Momo", Category: "Main Course", Price: 120, Available: true, Description: "Steamed dumplings"},
-		{Name: "Chowmein", Category: "Main Course", Price: 80, Available: true, Description: "Stir-fried noodles"},
-		{Name: "Burger", Category: "Fast Food", Price: 150, Available: true, Description: "Chicken/Veg burger"},
+		{Name: "Chiyaa (Tea)", Category: "Beverages", Price: models.FromMajor(20), Available: true, Description: "Traditional Nepali tea", Station: models.StationBarista},
+		{Name: "Coffee", Category: "Beverages", Price: models.FromMajor(50), Available: true, Description: "Hot coffee", Station: models.StationBarista},
+		{Name: "Cold Drink", Category: "Beverages", Price: models.FromMajor(40), Available: true, Description: "Soft drinks", Station: models.StationBar},
+		{Name: "Ice", Category: "Beverages", Price: models.FromMajor(10), Available: true, Description: "Ice cubes", Station: models.StationBar},
+		{Name: "Samosa", Category: "Snacks", Price: models.FromMajor(15), Available: true, Description: "Crispy vegetable samosa"},
+		{Name: "Momo", Category: "Main Course", Price: models.FromMajor(120), Available: true, Description: "Steamed dumplings"},
+		{Name: "Chowmein", Category: "Main Course", Price: models.FromMajor(80), Available: true, Description: "Stir-fried noodles"},
+		{Name: "Burger", Category: "Fast Food", Price: models.FromMajor(150), Available: true, Description: "Chicken/Veg burger"},
 	}
 	DB.Create(&menuItems)
 
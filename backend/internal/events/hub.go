@@ -0,0 +1,119 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type names a domain event.
+type Type string
+
+const (
+	TableStatusChanged     Type = "table.status_changed"
+	OrderCreated           Type = "order.created"
+	OrderStatusChanged     Type = "order.status_changed"
+	OrderItemAdded         Type = "order.item_added"
+	OrderItemStatusChanged Type = "order_item.status_changed"
+	PaymentRecorded        Type = "payment.recorded"
+	PaymentRefunded        Type = "payment.refunded"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+// Event is a change published to every device connected to a cafe.
+type Event struct {
+	ID       uint64      `json:"id"`
+	Type     Type        `json:"type"`
+	TenantID *uint       `json:"tenant_id,omitempty"`
+	At       time.Time   `json:"at"`
+	Data     interface{} `json:"data"`
+}
+
+// Hub fans events out to subscribers per cafe, and to subscribers of all
+// cafes (platform superadmins).
+type Hub struct {
+	nextID uint64 // first for 64-bit atomic alignment
+	mu     sync.RWMutex
+	subs   map[uint]map[chan Event]struct{}
+	all    map[chan Event]struct{}
+}
+
+// NewHub returns an empty hub.
+func NewHub() *Hub {
+	return &Hub{subs: map[uint]map[chan Event]struct{}{}, all: map[chan Event]struct{}{}}
+}
+
+// Default is the process-wide hub used by the HTTP handlers.
+var Default = NewHub()
+
+// Subscribe registers a subscriber for a cafe. The returned function
+// unsubscribes and closes the channel.
+func (h *Hub) Subscribe(tenantID uint) (<-chan Event, func()) {
+	return h.subscribe(tenantID, false)
+}
+
+// SubscribeAll registers a subscriber for the events of every cafe, which
+// only platform superadmins may see.
+func (h *Hub) SubscribeAll() (<-chan Event, func()) {
+	return h.subscribe(0, true)
+}
+
+func (h *Hub) subscribe(tenantID uint, all bool) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	set := h.all
+	if !all {
+		if h.subs[tenantID] == nil {
+			h.subs[tenantID] = map[chan Event]struct{}{}
+		}
+		set = h.subs[tenantID]
+	}
+	set[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(set, ch)
+			if !all && len(set) == 0 {
+				delete(h.subs, tenantID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers an event to the cafe's subscribers and to subscribers of
+// all cafes; an event without a cafe goes only to the latter. It never
+// blocks: a subscriber whose buffer is full misses the event and is expected
+// to reload.
+func (h *Hub) Publish(tenantID *uint, typ Type, data interface{}) {
+	event := Event{
+		ID:       atomic.AddUint64(&h.nextID, 1),
+		Type:     typ,
+		TenantID: tenantID,
+		At:       time.Now(),
+		Data:     data,
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	deliver := func(subs map[chan Event]struct{}) {
+		for ch := range subs {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+	if tenantID != nil {
+		deliver(h.subs[*tenantID])
+	}
+	deliver(h.all)
+}
@@ -0,0 +1,42 @@
+package events
+
+import "testing"
+
+func TestPublishReachesOnlyTheCafe(t *testing.T) {
+	h := NewHub()
+	cafe1, unsub1 := h.Subscribe(1)
+	defer unsub1()
+	cafe2, unsub2 := h.Subscribe(2)
+	defer unsub2()
+	all, unsubAll := h.SubscribeAll()
+	defer unsubAll()
+
+	one := uint(1)
+	h.Publish(&one, OrderCreated, nil)
+	h.Publish(nil, OrderCreated, nil)
+
+	if got := len(cafe1); got != 1 {
+		t.Errorf("cafe 1 received %d events, want 1", got)
+	}
+	if got := len(cafe2); got != 0 {
+		t.Errorf("cafe 2 received %d events, want 0", got)
+	}
+	if got := len(all); got != 2 {
+		t.Errorf("all cafes received %d events, want 2", got)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	h := NewHub()
+	stream, unsubscribe := h.Subscribe(1)
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-stream; ok {
+		t.Error("stream still open after unsubscribe")
+	}
+	if len(h.subs) != 0 {
+		t.Errorf("hub keeps %d cafe sets after the last subscriber left", len(h.subs))
+	}
+	one := uint(1)
+	h.Publish(&one, OrderCreated, nil)
+}
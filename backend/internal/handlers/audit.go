@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 500
+)
+
+// recordAudit writes an audit event for a mutation in the same transaction.
+// before and after are snapshotted as JSON; pass nil for a side that does not
+// exist, such as before on create.
+func recordAudit(tx *gorm.DB, c *gin.Context, action models.AuditAction, entity string, entityID uint, before, after interface{}) error {
+	return writeAudit(tx, models.AuditEvent{
+		TenantID:  getTenantID(c),
+		UserID:    getActorID(c),
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		IPAddress: c.ClientIP(),
+	}, before, after)
+}
+
+// writeAudit snapshots before and after into event and stores it. Background
+// jobs use it directly, leaving the user unset.
+func writeAudit(tx *gorm.DB, event models.AuditEvent, before, after interface{}) error {
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if event.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&event).Error
+}
+
+// GetAuditEvents lists audit events, newest first. Filters: entity,
+// entity_id, action, user_id, from and to (YYYY-MM-DD, inclusive), with
+// limit and offset for paging.
+func GetAuditEvents(c *gin.Context) {
+	query := platformScope(database.DB, c).Model(&models.AuditEvent{})
+
+	if entity := c.Query("entity"); entity != "" {
+		query = query.Where("entity = ?", entity)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if from := c.Query("from"); from != "" {
+		start, err := parseBusinessDay(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if to := c.Query("to"); to != "" {
+		end, err := parseBusinessDay(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+		query = query.Where("created_at < ?", end.AddDate(0, 0, 1))
+	}
+
+	limit := defaultAuditLimit
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+
+	var events []models.AuditEvent
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+)
+
+func TestAuditEventsOfThePlatform(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     models.UserRole
+		wantSeen []string
+	}{
+		{"cafe admin", models.RoleAdmin, []string{"customer"}},
+		{"manager", models.RoleManager, []string{"customer"}},
+		{"superadmin", models.RoleSuperAdmin, []string{"cafe", "customer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID, otherID := testTenantID, testTenantID+1
+			user := models.User{ID: testUserID, Username: "boss", Role: tt.role}
+			if tt.role != models.RoleSuperAdmin {
+				user.TenantID = &tenantID
+			}
+			mustCreate(t, db, &user)
+			mustCreate(t, db, &models.AuditEvent{TenantID: &tenantID, Entity: "customer", EntityID: 1, Action: models.AuditCreate})
+			mustCreate(t, db, &models.AuditEvent{TenantID: &otherID, Entity: "order", EntityID: 1, Action: models.AuditCreate})
+			mustCreate(t, db, &models.AuditEvent{Entity: "cafe", EntityID: 2, Action: models.AuditCreate})
+
+			w := testRequest(t, GetAuditEvents, nil, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Events []models.AuditEvent `json:"events"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			seen := map[string]bool{}
+			for _, event := range resp.Events {
+				seen[event.Entity] = true
+			}
+			if len(seen) != len(tt.wantSeen) {
+				t.Errorf("saw %v, want %v", seen, tt.wantSeen)
+			}
+			for _, entity := range tt.wantSeen {
+				if !seen[entity] {
+					t.Errorf("%s event not seen", entity)
+				}
+			}
+		})
+	}
+}
@@ -3,13 +3,16 @@ package handlers
 import (
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/middleware"
 	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
@@ -17,16 +20,12 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-type SignupRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
-	FullName string `json:"full_name"`
-	Role     string `json:"role"`
-}
-
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	ExpiresIn    int64        `json:"expires_in"`
+	User         UserResponse `json:"user"`
+	SessionID    uint         `json:"-"`
 }
 
 type UserResponse struct {
@@ -34,6 +33,27 @@ type UserResponse struct {
 	Username string `json:"username"`
 	FullName string `json:"full_name"`
 	Role     string `json:"role"`
+	TenantID *uint  `json:"tenant_id,omitempty"`
+
+	MustResetPassword bool                `json:"must_reset_password"`
+	Permissions       []models.Permission `json:"permissions,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+func newUserResponse(user models.User) UserResponse {
+	return UserResponse{
+		ID:                user.ID,
+		Username:          user.Username,
+		FullName:          user.FullName,
+		Role:              string(user.Role),
+		TenantID:          user.TenantID,
+		MustResetPassword: user.MustResetPassword,
+		Permissions:       user.Role.Permissions(),
+	}
 }
 
 func Login(c *gin.Context) {
@@ -54,101 +74,98 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateToken(user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	if !user.Active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
 		return
 	}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User: UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			FullName: user.FullName,
-			Role:     string(user.Role),
-		},
-	})
-}
-
-func Signup(c *gin.Context) {
-	var req SignupRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	// Staff may only sign in on their own cafe's domain
+	if tenantID := getTenantID(c); tenantID != nil && user.Role != models.RoleSuperAdmin {
+		if user.TenantID == nil || *user.TenantID != *tenantID {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
 	}
 
-	// Check if user already exists
-	var existingUser models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
+	// Start a session and issue tokens
+	resp, err := issueSession(database.DB, c, user, sessionOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Set default role if not provided
-	role := models.RoleFrontdesk
-	if req.Role != "" {
-		role = models.UserRole(req.Role)
-	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	user := models.User{
-		Username: req.Username,
-		FullName: req.FullName,
-		Role:     role,
-	}
+func GetMe(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-	if err := user.HashPassword(req.Password); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ChangePassword sets a new password for the current user, clears a forced
+// reset, signs out the user's other sessions and issues fresh tokens.
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateToken(user)
+	var resp AuthResponse
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := forUpdate(tx).First(&user, getUserID(c)).Error; err != nil {
+			return abortTx(http.StatusNotFound, "User not found")
+		}
+		if !user.CheckPassword(req.CurrentPassword) {
+			return abortTx(http.StatusUnauthorized, "Current password is incorrect")
+		}
+		if err := user.HashPassword(req.NewPassword); err != nil {
+			return abortTx(http.StatusInternalServerError, "Failed to hash password")
+		}
+		user.MustResetPassword = false
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":            user.Password,
+			"must_reset_password": false,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := revokeSessions(tx, user.ID); err != nil {
+			return err
+		}
+		var err error
+		resp, err = issueSession(tx, c, user, sessionOptions{})
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		respondTxError(c, err, "Failed to change password")
 		return
 	}
 
-	c.JSON(http.StatusCreated, AuthResponse{
-		Token: token,
-		User: UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			FullName: user.FullName,
-			Role:     string(user.Role),
-		},
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
-func GetMe(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, UserResponse{
-		ID:       user.ID,
+// generateToken issues a short-lived access token bound to a session
+func generateToken(user models.User, sessionID uint, ttl time.Duration) (string, error) {
+	claims := middleware.Claims{
+		UserID:   user.ID,
 		Username: user.Username,
-		FullName: user.FullName,
 		Role:     string(user.Role),
-	})
-}
+		TenantID: user.TenantID,
 
-func generateToken(user models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+		MustResetPassword: user.MustResetPassword,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        strconv.FormatUint(uint64(sessionID), 10),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
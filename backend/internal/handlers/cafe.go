@@ -2,11 +2,14 @@ package handlers
 
 import (
     "net/http"
+    "strings"
 
     "altia-cafe-backend/internal/database"
+    "altia-cafe-backend/internal/middleware"
     "altia-cafe-backend/internal/models"
 
     "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
 )
 
 // List cafes (platform-level, not scoped by tenant)
@@ -35,15 +38,23 @@ func CreateCafe(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
+    cafe.Subdomain = strings.ToLower(strings.TrimSpace(cafe.Subdomain))
     if cafe.Subdomain == "" {
         c.JSON(http.StatusBadRequest, gin.H{"error": "subdomain is required"})
         return
     }
     cafe.Active = true
-    if err := database.DB.Create(&cafe).Error; err != nil {
+    err := database.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(&cafe).Error; err != nil {
+            return err
+        }
+        return recordAudit(tx, c, models.AuditCreate, "cafe", cafe.ID, nil, cafe)
+    })
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create cafe"})
         return
     }
+    middleware.InvalidateTenantCache()
     c.JSON(http.StatusCreated, cafe)
 }
 
@@ -64,23 +75,42 @@ func UpdateCafe(c *gin.Context) {
 
     updates := map[string]interface{}{
         "name":      payload.Name,
-        "subdomain": payload.Subdomain,
+        "subdomain": strings.ToLower(strings.TrimSpace(payload.Subdomain)),
         "active":    payload.Active,
     }
 
-    if err := database.DB.Model(&cafe).Updates(updates).Error; err != nil {
+    before := cafe
+    err := database.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&cafe).Updates(updates).Error; err != nil {
+            return err
+        }
+        return recordAudit(tx, c, models.AuditUpdate, "cafe", cafe.ID, before, cafe)
+    })
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cafe"})
         return
     }
+    middleware.InvalidateTenantCache()
 
     c.JSON(http.StatusOK, cafe)
 }
 
 func DeleteCafe(c *gin.Context) {
     id := c.Param("id")
-    if err := database.DB.Delete(&models.Cafe{}, id).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cafe"})
+    err := database.DB.Transaction(func(tx *gorm.DB) error {
+        var cafe models.Cafe
+        if err := tx.First(&cafe, id).Error; err != nil {
+            return abortTx(http.StatusNotFound, "Cafe not found")
+        }
+        if err := tx.Delete(&cafe).Error; err != nil {
+            return err
+        }
+        return recordAudit(tx, c, models.AuditDelete, "cafe", cafe.ID, cafe, nil)
+    })
+    if err != nil {
+        respondTxError(c, err, "Failed to delete cafe")
         return
     }
+    middleware.InvalidateTenantCache()
     c.JSON(http.StatusOK, gin.H{"message": "Cafe deleted"})
 }
@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OpenCashSessionRequest opens a drawer. TerminalID defaults to the terminal
+// the user signed in on with their PIN.
+type OpenCashSessionRequest struct {
+	TerminalID   *uint        `json:"terminal_id"`
+	OpeningFloat models.Money `json:"opening_float"`
+	Notes        string       `json:"notes"`
+}
+
+type CashMovementRequest struct {
+	Type   models.CashMovementType `json:"type" binding:"required"`
+	Amount models.Money            `json:"amount" binding:"required"`
+	Reason string                  `json:"reason" binding:"required"`
+}
+
+type CloseCashSessionRequest struct {
+	Counted *models.Money `json:"counted" binding:"required"`
+	Notes   string        `json:"notes"`
+}
+
+// CashSessionReport is the shift report of a cash session: what was taken
+// in it by each payment method and how the drawer adds up.
+type CashSessionReport struct {
+	Session      models.CashSession   `json:"session"`
+	Payments     []models.MethodTotal `json:"payments"`
+	CashPayments []models.Payment     `json:"cash_payments"`
+	CashSales    models.Money         `json:"cash_sales"`
+	CashIn       models.Money         `json:"cash_in"`
+	CashOut      models.Money         `json:"cash_out"`
+	ExpectedCash models.Money         `json:"expected_cash"`
+	CountedCash  *models.Money        `json:"counted_cash,omitempty"`
+	Variance     models.Money         `json:"variance"`
+}
+
+// shiftPayments selects the payments taken in the session and the refunds
+// paid out of it. Payments recorded before they were linked to sessions
+// count towards the session of the user who took them while it was open.
+func shiftPayments(tx *gorm.DB, session models.CashSession) *gorm.DB {
+	until := time.Now()
+	if session.ClosedAt != nil {
+		until = *session.ClosedAt
+	}
+	return cafeScope(tx.Model(&models.Payment{}), session.TenantID).
+		Where("cash_session_id = ? OR (cash_session_id IS NULL AND created_by_id = ? AND created_at >= ? AND created_at < ?)",
+			session.ID, session.UserID, session.OpenedAt, until)
+}
+
+// userCashSession returns the ID of the cash session the user has open, if
+// any.
+func userCashSession(tx *gorm.DB, userID *uint) (*uint, error) {
+	if userID == nil {
+		return nil, nil
+	}
+	return openCashSession(tx.Where("user_id = ?", *userID))
+}
+
+// refundCashSession returns the ID of the cash session a refund of payment
+// is paid out of: the one the payment was taken in while it is still open,
+// else the one open on the same terminal, else the refunding user's.
+func refundCashSession(tx *gorm.DB, c *gin.Context, payment models.Payment) (*uint, error) {
+	if payment.CashSessionID != nil {
+		var taken models.CashSession
+		if err := tx.First(&taken, *payment.CashSessionID).Error; err != nil {
+			return nil, err
+		}
+		if taken.Status == models.CashSessionOpen {
+			return &taken.ID, nil
+		}
+		id, err := openCashSession(tx.Where("terminal_id = ?", taken.TerminalID))
+		if id != nil || err != nil {
+			return id, err
+		}
+	}
+	return userCashSession(tx, getActorID(c))
+}
+
+// openCashSession returns the ID of the open cash session query finds, if
+// any.
+func openCashSession(query *gorm.DB) (*uint, error) {
+	var session models.CashSession
+	err := query.Where("status = ?", models.CashSessionOpen).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session.ID, nil
+}
+
+// expectedCash returns what the drawer should hold: the opening float, plus
+// the cash payments of the shift, plus cash paid in, less cash paid out.
+func expectedCash(tx *gorm.DB, session models.CashSession) (models.Money, error) {
+	var sales models.Money
+	if err := shiftPayments(tx, session).
+		Where("method = ?", models.CashPaymentMethod).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&sales).Error; err != nil {
+		return 0, err
+	}
+
+	var movements []models.CashMovement
+	if err := tx.Where("cash_session_id = ?", session.ID).Find(&movements).Error; err != nil {
+		return 0, err
+	}
+	expected := session.OpeningFloat.Add(sales)
+	for _, m := range movements {
+		expected = expected.Add(m.Signed())
+	}
+	return expected, nil
+}
+
+// withExpectedCash fills in the running expected cash of an open session.
+// Closed sessions keep the figure taken when they were counted.
+func withExpectedCash(tx *gorm.DB, session *models.CashSession) error {
+	if session.Status != models.CashSessionOpen {
+		return nil
+	}
+	expected, err := expectedCash(tx, *session)
+	if err != nil {
+		return err
+	}
+	session.ExpectedCash = expected
+	return nil
+}
+
+// findCashSession loads a cash session the caller may work with: their own,
+// or anyone's for those who reconcile drawers.
+func findCashSession(db *gorm.DB, c *gin.Context) (models.CashSession, error) {
+	var session models.CashSession
+	if err := applyTenantScope(db, c).First(&session, c.Param("id")).Error; err != nil {
+		return session, abortTx(http.StatusNotFound, "Cash session not found")
+	}
+	role := models.UserRole(c.GetString("role"))
+	if session.UserID != getUserID(c) && !role.Can(models.PermCashReconcile) {
+		return session, abortTx(http.StatusForbidden, "Not your cash session")
+	}
+	return session, nil
+}
+
+// OpenCashSession starts the caller's shift on a terminal's drawer. A
+// terminal and a user can each have only one drawer open at a time.
+func OpenCashSession(c *gin.Context) {
+	var req OpenCashSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.OpeningFloat < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "opening_float must not be negative"})
+		return
+	}
+	terminalID := c.GetUint("terminal_id")
+	if req.TerminalID != nil {
+		terminalID = *req.TerminalID
+	}
+	if terminalID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "terminal_id is required when not signed in on a terminal"})
+		return
+	}
+
+	session := models.CashSession{
+		TenantID:     getTenantID(c),
+		TerminalID:   terminalID,
+		UserID:       getUserID(c),
+		Status:       models.CashSessionOpen,
+		OpenedAt:     time.Now(),
+		OpeningFloat: req.OpeningFloat,
+		Notes:        req.Notes,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the terminal so two users cannot open its drawer at once
+		var terminal models.Terminal
+		if err := applyTenantScope(forUpdate(tx), c).First(&terminal, terminalID).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Terminal not found")
+		}
+
+		var open models.CashSession
+		err := tx.Where("status = ? AND (terminal_id = ? OR user_id = ?)", models.CashSessionOpen, terminal.ID, session.UserID).
+			First(&open).Error
+		if err == nil {
+			if open.UserID == session.UserID {
+				return abortTx(http.StatusConflict, fmt.Sprintf("You already have cash session #%d open", open.ID))
+			}
+			return abortTx(http.StatusConflict, fmt.Sprintf("%s already has cash session #%d open", terminal.Name, open.ID))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "cash_session", session.ID, nil, session)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to open cash session")
+		return
+	}
+
+	database.DB.Preload("Terminal").Preload("User").First(&session, session.ID)
+	session.ExpectedCash = session.OpeningFloat
+	c.JSON(http.StatusCreated, session)
+}
+
+// GetCurrentCashSession returns the caller's open cash session with its
+// running expected cash.
+func GetCurrentCashSession(c *gin.Context) {
+	var session models.CashSession
+	err := applyTenantScope(database.DB, c).Preload("Terminal").Preload("Movements").
+		Where("user_id = ? AND status = ?", getUserID(c), models.CashSessionOpen).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No open cash session"})
+		return
+	}
+	if err == nil {
+		err = withExpectedCash(database.DB, &session)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// GetCashSessions lists cash sessions, newest first. Sessions can be
+// filtered by status, user_id and terminal_id, and by the days they were
+// opened with from and to.
+func GetCashSessions(c *gin.Context) {
+	query := applyTenantScope(database.DB, c).Preload("Terminal").Preload("User")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if terminalID := c.Query("terminal_id"); terminalID != "" {
+		query = query.Where("terminal_id = ?", terminalID)
+	}
+	if c.Query("from") != "" || c.Query("to") != "" {
+		start, end, err := reportRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("opened_at >= ? AND opened_at < ?", start, end)
+	}
+
+	sessions := []models.CashSession{}
+	err := query.Order("opened_at DESC").Find(&sessions).Error
+	for i := range sessions {
+		if err != nil {
+			break
+		}
+		err = withExpectedCash(database.DB, &sessions[i])
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// GetCashSession returns a cash session with its movements.
+func GetCashSession(c *gin.Context) {
+	session, err := findCashSession(database.DB.Preload("Terminal").Preload("User").Preload("Movements"), c)
+	if err == nil {
+		err = withExpectedCash(database.DB, &session)
+	}
+	if err != nil {
+		respondTxError(c, err, "Failed to fetch cash session")
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// AddCashMovement records cash paid into or out of an open drawer. Cash
+// cannot be paid out of a drawer that does not hold it.
+func AddCashMovement(c *gin.Context) {
+	var req CashMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Type != models.CashIn && req.Type != models.CashOut {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be cash_in or cash_out"})
+		return
+	}
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+
+	var movement models.CashMovement
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		session, err := findCashSession(forUpdate(tx), c)
+		if err != nil {
+			return err
+		}
+		if session.Status != models.CashSessionOpen {
+			return abortTx(http.StatusConflict, "Cash session is closed")
+		}
+		if req.Type == models.CashOut {
+			expected, err := expectedCash(tx, session)
+			if err != nil {
+				return err
+			}
+			if req.Amount > expected {
+				return abortTx(http.StatusConflict, "Drawer holds only "+expected.String())
+			}
+		}
+
+		movement = models.CashMovement{
+			TenantID:      session.TenantID,
+			CashSessionID: session.ID,
+			Type:          req.Type,
+			Amount:        req.Amount,
+			Reason:        req.Reason,
+			CreatedByID:   getActorID(c),
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "cash_movement", movement.ID, nil, movement)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to record cash movement")
+		return
+	}
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// CloseCashSession ends a shift with the cash counted in the drawer. The
+// expected cash is fixed at close and the variance is counted less
+// expected, so a shortfall is negative.
+func CloseCashSession(c *gin.Context) {
+	var req CloseCashSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.Counted < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "counted must not be negative"})
+		return
+	}
+
+	var session models.CashSession
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if session, err = findCashSession(forUpdate(tx), c); err != nil {
+			return err
+		}
+		if session.Status != models.CashSessionOpen {
+			return abortTx(http.StatusConflict, "Cash session is already closed")
+		}
+		before := session
+
+		now := time.Now()
+		session.ClosedAt = &now
+		expected, err := expectedCash(tx, session)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"status":        models.CashSessionClosed,
+			"closed_at":     now,
+			"closed_by_id":  getActorID(c),
+			"expected_cash": expected,
+			"counted_cash":  *req.Counted,
+			"variance":      req.Counted.Sub(expected),
+		}
+		if req.Notes != "" {
+			updates["notes"] = req.Notes
+		}
+		if err := tx.Model(&session).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&session, session.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "cash_session", session.ID, before, session)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to close cash session")
+		return
+	}
+
+	database.DB.Preload("Terminal").Preload("User").Preload("Movements").First(&session, session.ID)
+	c.JSON(http.StatusOK, session)
+}
+
+// GetCashSessionReport returns the shift report of a cash session, running
+// for an open session and final for a closed one.
+func GetCashSessionReport(c *gin.Context) {
+	var report CashSessionReport
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		session, err := findCashSession(tx.Preload("Terminal").Preload("User").Preload("Movements", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}), c)
+		if err != nil {
+			return err
+		}
+		if err := withExpectedCash(tx, &session); err != nil {
+			return err
+		}
+		report = CashSessionReport{
+			Session:      session,
+			Payments:     []models.MethodTotal{},
+			CashPayments: []models.Payment{},
+			ExpectedCash: session.ExpectedCash,
+			CountedCash:  session.CountedCash,
+			Variance:     session.Variance,
+		}
+
+		if err := shiftPayments(tx, session).
+			Select(methodTotalColumns).
+			Group("method").
+			Order("amount DESC").
+			Scan(&report.Payments).Error; err != nil {
+			return err
+		}
+		if err := shiftPayments(tx, session).Preload("Customer").
+			Where("method = ?", models.CashPaymentMethod).
+			Order("created_at").
+			Find(&report.CashPayments).Error; err != nil {
+			return err
+		}
+		for _, p := range report.CashPayments {
+			report.CashSales = report.CashSales.Add(p.Amount)
+		}
+		for _, m := range session.Movements {
+			if m.Type == models.CashOut {
+				report.CashOut = report.CashOut.Add(m.Amount)
+			} else {
+				report.CashIn = report.CashIn.Add(m.Amount)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to build shift report")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
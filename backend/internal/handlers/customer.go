@@ -7,6 +7,7 @@ import (
 	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetCustomers(c *gin.Context) {
@@ -31,6 +32,23 @@ func GetCustomer(c *gin.Context) {
 	c.JSON(http.StatusOK, customer)
 }
 
+// ensurePhoneFree refuses a phone number another customer of the cafe has.
+func ensurePhoneFree(tx *gorm.DB, c *gin.Context, phone string, exceptID uint) error {
+	if phone == "" {
+		return nil
+	}
+	var count int64
+	if err := strictTenantScope(tx.Model(&models.Customer{}), c).
+		Where("phone = ? AND id <> ?", phone, exceptID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return abortTx(http.StatusConflict, "Another customer has this phone number")
+	}
+	return nil
+}
+
 func CreateCustomer(c *gin.Context) {
 	var customer models.Customer
 	if err := c.ShouldBindJSON(&customer); err != nil {
@@ -38,15 +56,23 @@ func CreateCustomer(c *gin.Context) {
 		return
 	}
 
-	// Set initial credit balance to 0 if not provided
-	if customer.CreditBalance == 0 {
-		customer.CreditBalance = 0
-	}
+	// New customers start owing nothing; an opening balance is posted as a
+	// ledger adjustment, which needs ledger.adjust
+	customer.CreditBalance = 0
 
 	// Assign tenant
 	customer.TenantID = getTenantID(c)
-	if err := database.DB.Create(&customer).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer"})
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ensurePhoneFree(tx, c, customer.Phone, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&customer).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "customer", customer.ID, nil, customer)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to create customer")
 		return
 	}
 
@@ -73,8 +99,18 @@ func UpdateCustomer(c *gin.Context) {
 		"phone": updateData.Phone,
 	}
 
-	if err := database.DB.Model(&customer).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer"})
+	before := customer
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ensurePhoneFree(tx, c, updateData.Phone, customer.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(&customer).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "customer", customer.ID, before, customer)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update customer")
 		return
 	}
 
@@ -83,8 +119,19 @@ func UpdateCustomer(c *gin.Context) {
 
 func DeleteCustomer(c *gin.Context) {
 	id := c.Param("id")
-	if err := applyTenantScope(database.DB, c).Delete(&models.Customer{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer"})
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var customer models.Customer
+		if err := forUpdate(applyTenantScope(tx, c)).First(&customer, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Customer not found")
+		}
+		if err := tx.Delete(&customer).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditDelete, "customer", customer.ID, customer, nil)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to delete customer")
 		return
 	}
 
@@ -95,8 +142,7 @@ func GetCustomerBalance(c *gin.Context) {
 	id := c.Param("id")
 
 	var customer models.Customer
-	tenant, _ := c.Get("tenant")
-	if err := database.DB.Where("tenant_id = ?", tenant).First(&customer, id).Error; err != nil {
+	if err := applyTenantScope(database.DB, c).First(&customer, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 		return
 	}
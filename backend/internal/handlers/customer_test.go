@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateCustomerIgnoresBalance(t *testing.T) {
+	db := testDB(t)
+	staff(t, db)
+
+	w := testRequestAs(t, testCashierID, CreateCustomer, nil, gin.H{"name": "Ram", "credit_balance": models.Money(-50000)})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var customer models.Customer
+	if err := json.Unmarshal(w.Body.Bytes(), &customer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.First(&customer, customer.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if customer.CreditBalance != 0 {
+		t.Errorf("credit balance = %s, want 0", customer.CreditBalance)
+	}
+	var entries int64
+	db.Model(&models.LedgerEntry{}).Where("customer_id = ?", customer.ID).Count(&entries)
+	if entries != 0 {
+		t.Errorf("%d ledger entries posted, want none", entries)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/middleware"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testTenantID uint = 1
+	testUserID   uint = 1
+)
+
+// testDB points database.DB at a new SQLite database with the schema
+// migrated, and puts the previous connection back when the test ends.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.Cafe{},
+		&models.User{},
+		&models.Customer{},
+		&models.Table{},
+		&models.MenuItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.Payment{},
+		&models.LedgerEntry{},
+		&models.Invitation{},
+		&models.AuditEvent{},
+		&models.BillGroup{},
+		&models.TaxRate{},
+		&models.Invoice{},
+		&models.ZReport{},
+		&models.Terminal{},
+		&models.CashSession{},
+		&models.CashMovement{},
+		&models.Session{},
+		&models.Reservation{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = prev
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// testRequest calls handler as the test user of the test cafe with body as
+// JSON and returns the response.
+func testRequest(t *testing.T, handler gin.HandlerFunc, params gin.Params, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return testRequestAs(t, testUserID, handler, params, body)
+}
+
+// testRequestAs is testRequest made by another user of the test cafe.
+func testRequestAs(t *testing.T, userID uint, handler gin.HandlerFunc, params gin.Params, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewReader(data))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set(middleware.TenantKey, testTenantID)
+	c.Set("user_id", userID)
+	// Act with the user's role when the test created them
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err == nil {
+		c.Set("role", string(user.Role))
+	}
+	handler(c)
+	return w
+}
+
+// mustCreate inserts value or fails the test.
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/events"
+	"altia-cafe-backend/internal/middleware"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventHeartbeat is how often an idle stream is pinged; each ping also
+// rechecks that the session has not been revoked.
+const eventHeartbeat = 25 * time.Second
+
+// eventPermissions is the permission needed to receive each event type.
+var eventPermissions = map[events.Type]models.Permission{
+	events.TableStatusChanged:     models.PermTableView,
+	events.OrderCreated:           models.PermOrderView,
+	events.OrderStatusChanged:     models.PermOrderView,
+	events.OrderItemAdded:         models.PermOrderView,
+	events.OrderItemStatusChanged: models.PermOrderView,
+	events.PaymentRecorded:        models.PermPaymentView,
+	events.PaymentRefunded:        models.PermPaymentView,
+}
+
+// publish sends an event to every device connected to the request's cafe.
+// Call it only after the change has been committed.
+func publish(c *gin.Context, typ events.Type, data interface{}) {
+	events.Default.Publish(getTenantID(c), typ, data)
+}
+
+// pendingEvents collects the events raised inside a transaction so they can
+// be published once it has committed.
+type pendingEvents []events.Event
+
+func (p *pendingEvents) add(typ events.Type, data interface{}) {
+	*p = append(*p, events.Event{Type: typ, Data: data})
+}
+
+func (p pendingEvents) publish(c *gin.Context) {
+	for _, event := range p {
+		publish(c, event.Type, event.Data)
+	}
+}
+
+// CreateStreamTicket issues a short-lived, single-use ticket that opens the
+// caller's event stream, so the access token never has to go in its URL.
+func CreateStreamTicket(c *gin.Context) {
+	ticket, expiresAt, err := middleware.IssueStreamTicket(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue stream ticket"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ticket": ticket, "expires_at": expiresAt})
+}
+
+// StreamEvents streams the cafe's events as Server-Sent Events. Each event's
+// name is its type and its data the JSON event. Events the user's role may
+// not view are skipped. Without a cafe, only a superadmin receives events,
+// those of every cafe. The stream ends when the session is revoked.
+func StreamEvents(c *gin.Context) {
+	role := models.UserRole(c.GetString("role"))
+	sessionID := c.GetUint("session_id")
+
+	// A nil stream never delivers, leaving only the heartbeat
+	var stream <-chan events.Event
+	unsubscribe := func() {}
+	if tenantID, ok := middleware.TenantID(c); ok {
+		stream, unsubscribe = events.Default.Subscribe(tenantID)
+	} else if role == models.RoleSuperAdmin {
+		stream, unsubscribe = events.Default.SubscribeAll()
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-stream:
+			if !ok {
+				return false
+			}
+			if role.Can(eventPermissions[event.Type]) {
+				c.SSEvent(string(event.Type), event)
+			}
+			return true
+		case <-heartbeat.C:
+			var session models.Session
+			if err := database.DB.First(&session, sessionID).Error; err != nil || !session.Active(time.Now()) {
+				return false
+			}
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		}
+	})
+}
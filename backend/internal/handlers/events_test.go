@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"altia-cafe-backend/internal/middleware"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamTicket issues a stream ticket in session as the test user.
+func streamTicket(t *testing.T, session models.Session) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/events/ticket", nil)
+	c.Set(middleware.TenantKey, testTenantID)
+	c.Set("user_id", session.UserID)
+	c.Set("role", string(models.RoleFrontdesk))
+	c.Set("session_id", session.ID)
+	CreateStreamTicket(c)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("issue ticket: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode ticket: %v", err)
+	}
+	return resp.Ticket
+}
+
+func TestStreamTicket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testDB(t)
+	session := models.Session{UserID: testUserID, TokenHash: "a", ExpiresAt: time.Now().Add(time.Hour)}
+	mustCreate(t, db, &session)
+
+	// open answers with the user the ticket authenticated, in the cafe given
+	open := func(ticket string, tenantID uint) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.GET("/events", func(c *gin.Context) {
+			c.Set(middleware.TenantKey, tenantID)
+		}, middleware.StreamTicketAuth(), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id"), "role": c.GetString("role")})
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/events?ticket="+ticket, nil))
+		return w
+	}
+
+	ticket := streamTicket(t, session)
+	if w := open(ticket, testTenantID); w.Code != http.StatusOK {
+		t.Fatalf("first use: status %d: %s", w.Code, w.Body)
+	} else if got, want := w.Body.String(), `{"role":"frontdesk","user_id":1}`; got != want {
+		t.Errorf("first use authenticated %s, want %s", got, want)
+	}
+	if w := open(ticket, testTenantID); w.Code != http.StatusUnauthorized {
+		t.Errorf("second use: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := open("", testTenantID); w.Code != http.StatusUnauthorized {
+		t.Errorf("no ticket: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := open(streamTicket(t, session), testTenantID+1); w.Code != http.StatusForbidden {
+		t.Errorf("other cafe: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// A ticket dies with the session it was issued in
+	ticket = streamTicket(t, session)
+	now := time.Now()
+	db.Model(&session).Update("revoked_at", &now)
+	if w := open(ticket, testTenantID); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -1,47 +1,171 @@
 package handlers
 
 import (
-	"strconv"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"altia-cafe-backend/internal/middleware"
+	"altia-cafe-backend/internal/models"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// getTenantID extracts tenant from context and converts to *uint
+// getTenantID returns the cafe resolved by TenantMiddleware as *uint
 func getTenantID(c *gin.Context) *uint {
-	if t, ok := c.Get("tenant"); ok {
-		if s, ok2 := t.(string); ok2 && s != "" {
-			if id, err := strconv.ParseUint(s, 10, 32); err == nil {
-				tenantID := uint(id)
-				return &tenantID
-			}
-		}
+	if id, ok := middleware.TenantID(c); ok {
+		return &id
 	}
 	return nil
 }
 
-// getTenantString extracts tenant from context as string for queries
-func getTenantString(c *gin.Context) string {
-	if t, ok := c.Get("tenant"); ok {
-		if s, ok2 := t.(string); ok2 {
-			return s
+// getUserID returns the authenticated user's ID set by AuthMiddleware
+func getUserID(c *gin.Context) uint {
+	if v, ok := c.Get("user_id"); ok {
+		if id, ok := v.(uint); ok {
+			return id
 		}
 	}
-	return ""
+	return 0
+}
+
+// getActorID returns the authenticated user's ID for created_by/updated_by
+// columns, or nil outside an authenticated request
+func getActorID(c *gin.Context) *uint {
+	if id := getUserID(c); id != 0 {
+		return &id
+	}
+	return nil
 }
 
 // applyTenantScope applies tenant scoping to a GORM query
-// If tenant is empty, returns query without tenant filtering (development mode)
-// If tenant is numeric, it queries for that specific tenant_id
+// If no tenant was resolved, returns query without tenant filtering (development mode)
+// Otherwise it queries for rows of that tenant_id, plus shared rows without a
+// tenant unless strict tenancy is enabled
 func applyTenantScope(db *gorm.DB, c *gin.Context) *gorm.DB {
-	tenant := getTenantString(c)
-	if tenant == "" {
+	tenantID := getTenantID(c)
+	strict := middleware.StrictTenancy()
+	if tenantID == nil {
+		if strict {
+			// Strict mode: nothing is visible without a cafe
+			return db.Where("1 = 0")
+		}
 		// Development mode: no tenant filtering
 		return db
 	}
-	// Try to parse as uint
-	if id, err := strconv.ParseUint(tenant, 10, 32); err == nil {
-		return db.Where("tenant_id = ? OR tenant_id IS NULL", uint(id))
+	if strict {
+		return db.Where("tenant_id = ?", *tenantID)
+	}
+	return db.Where("tenant_id = ? OR tenant_id IS NULL", *tenantID)
+}
+
+// strictTenantScope limits a query to the rows of the current cafe, or to
+// rows without a cafe when none was resolved, whatever the tenancy mode. Use
+// it where shared rows must not be mixed in, such as money totals and
+// per-cafe uniqueness.
+func strictTenantScope(db *gorm.DB, c *gin.Context) *gorm.DB {
+	if tenantID := getTenantID(c); tenantID != nil {
+		return db.Where("tenant_id = ?", *tenantID)
 	}
-	// Shouldn't reach here with proper setup
-	return db
+	return db.Where("tenant_id IS NULL")
+}
+
+// platformScope limits a query to rows of the current cafe, whatever the
+// tenancy mode, for records that also exist at platform level such as
+// staff, invitations and audit events. Rows without a cafe, such as those
+// of platform superadmins, are seen only by superadmins.
+func platformScope(db *gorm.DB, c *gin.Context) *gorm.DB {
+	tenantID := getTenantID(c)
+	if models.UserRole(c.GetString("role")) == models.RoleSuperAdmin {
+		if tenantID == nil {
+			return db
+		}
+		return db.Where("tenant_id = ? OR tenant_id IS NULL", *tenantID)
+	}
+	if tenantID == nil {
+		return db.Where("1 = 0")
+	}
+	return db.Where("tenant_id = ?", *tenantID)
+}
+
+// cafeScope limits a query to the rows of one cafe, or to rows without a
+// cafe when tenantID is nil. It is strictTenantScope for a cafe taken from a
+// record rather than the request, such as a Z-report's or a cash session's.
+func cafeScope(db *gorm.DB, tenantID *uint) *gorm.DB {
+	if tenantID == nil {
+		return db.Where("tenant_id IS NULL")
+	}
+	return db.Where("tenant_id = ?", *tenantID)
+}
+
+// forUpdate adds a SELECT ... FOR UPDATE lock to a query. It must only be used
+// on a transaction handle.
+func forUpdate(db *gorm.DB) *gorm.DB {
+	return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// advisoryLock takes a Postgres advisory lock on key that is held until the
+// transaction ends. Other databases, such as the SQLite used in tests, run
+// one writer at a time and need no lock.
+func advisoryLock(tx *gorm.DB, key int64) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", key).Error
+}
+
+// advisoryLockShared is advisoryLock in shared mode: holders of the shared
+// lock only exclude a holder of the exclusive one.
+func advisoryLockShared(tx *gorm.DB, key int64) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock_shared(?)", key).Error
+}
+
+// txError is returned from inside a transaction closure to roll back and
+// report a specific status and message to the client.
+type txError struct {
+	status  int
+	message string
+}
+
+func (e *txError) Error() string {
+	return e.message
+}
+
+func abortTx(status int, message string) error {
+	return &txError{status: status, message: message}
+}
+
+// respondTxError writes the response for an error returned by a transaction.
+// Errors raised with abortTx keep their status; anything else is reported as a
+// 500 with the given fallback message.
+func respondTxError(c *gin.Context, err error, fallback string) {
+	var te *txError
+	if errors.As(err, &te) {
+		c.JSON(te.status, gin.H{"error": te.message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
+
+// newOpaqueToken returns a random URL-safe token and the hash to store for it.
+func newOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken hashes an opaque token for storage and lookup.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
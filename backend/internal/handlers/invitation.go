@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultInvitationTTL = 72 * time.Hour
+	maxInvitationTTL     = 30 * 24 * time.Hour
+)
+
+type CreateInvitationRequest struct {
+	Role           string `json:"role" binding:"required"`
+	FullName       string `json:"full_name"`
+	TenantID       *uint  `json:"tenant_id"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+	FullName string `json:"full_name"`
+}
+
+func GetInvitations(c *gin.Context) {
+	var invitations []models.Invitation
+	query := platformScope(database.DB, c).Order("created_at DESC")
+
+	// Filter to invitations that can still be redeemed
+	if c.Query("status") == "pending" {
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+
+	if err := query.Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// CreateInvitation issues a single-use invite token for a role in the
+// caller's cafe. The token is returned only in this response.
+func CreateInvitation(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.UserRole(req.Role)
+	if !role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	inviterRole := models.UserRole(c.GetString("role"))
+	tenantID := getTenantID(c)
+	if inviterRole == models.RoleSuperAdmin && req.TenantID != nil {
+		var cafe models.Cafe
+		if err := database.DB.First(&cafe, *req.TenantID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cafe not found"})
+			return
+		}
+		tenantID = &cafe.ID
+	}
+
+	switch {
+	case role == models.RoleSuperAdmin && inviterRole != models.RoleSuperAdmin:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a superadmin can invite superadmins"})
+		return
+	case role == models.RoleSuperAdmin:
+		// Platform operators are not bound to a cafe
+		tenantID = nil
+	case tenantID == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation requires a cafe"})
+		return
+	}
+
+	ttl := defaultInvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if ttl > maxInvitationTTL {
+		ttl = maxInvitationTTL
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation"})
+		return
+	}
+
+	invitation := models.Invitation{
+		TenantID:    tenantID,
+		TokenHash:   hash,
+		Role:        role,
+		FullName:    req.FullName,
+		CreatedByID: getUserID(c),
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "invitation", invitation.ID, nil, invitation)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+		"token":      token,
+	})
+}
+
+func RevokeInvitation(c *gin.Context) {
+	id := c.Param("id")
+
+	var invitation models.Invitation
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := platformScope(forUpdate(tx), c).First(&invitation, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Invitation not found")
+		}
+		if !invitation.Pending(time.Now()) {
+			return abortTx(http.StatusConflict, "Invitation is no longer pending")
+		}
+
+		before := invitation
+		now := time.Now()
+		if err := tx.Model(&invitation).Update("revoked_at", &now).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "invitation", invitation.ID, before, invitation)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to revoke invitation")
+		return
+	}
+
+	c.JSON(http.StatusOK, invitation)
+}
+
+// AcceptInvitation redeems an invite token and creates the staff account
+// with the role and cafe chosen by the inviter.
+func AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		if err := forUpdate(tx).Where("token_hash = ?", hashToken(req.Token)).First(&invitation).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Invitation not found")
+		}
+		if !invitation.Pending(time.Now()) {
+			return abortTx(http.StatusGone, "Invitation has expired or was already used")
+		}
+
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return abortTx(http.StatusBadRequest, "Username already exists")
+		}
+
+		user = models.User{
+			TenantID: invitation.TenantID,
+			Username: req.Username,
+			FullName: req.FullName,
+			Role:     invitation.Role,
+		}
+		if user.FullName == "" {
+			user.FullName = invitation.FullName
+		}
+		if err := user.HashPassword(req.Password); err != nil {
+			return abortTx(http.StatusInternalServerError, "Failed to hash password")
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return abortTx(http.StatusInternalServerError, "Failed to create user")
+		}
+		if err := recordAudit(tx, c, models.AuditCreate, "user", user.ID, nil, user); err != nil {
+			return err
+		}
+
+		before := invitation
+		now := time.Now()
+		if err := tx.Model(&invitation).Updates(map[string]interface{}{
+			"accepted_at": &now,
+			"user_id":     user.ID,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "invitation", invitation.ID, before, invitation)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to accept invitation")
+		return
+	}
+
+	// Start a session and issue tokens
+	resp, err := issueSession(database.DB, c, user, sessionOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInvitationsOfThePlatform(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       models.UserRole
+		wantSeen   int
+		wantRevoke int
+	}{
+		{"cafe admin", models.RoleAdmin, 1, http.StatusNotFound},
+		{"superadmin", models.RoleSuperAdmin, 2, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID := testTenantID
+			user := models.User{ID: testUserID, Username: "boss", Role: tt.role}
+			if tt.role != models.RoleSuperAdmin {
+				user.TenantID = &tenantID
+			}
+			mustCreate(t, db, &user)
+			expires := time.Now().Add(time.Hour)
+			cafe := models.Invitation{TenantID: &tenantID, TokenHash: "cafe", Role: models.RoleWaiter, CreatedByID: testUserID, ExpiresAt: expires}
+			platform := models.Invitation{TokenHash: "platform", Role: models.RoleSuperAdmin, CreatedByID: testUserID, ExpiresAt: expires}
+			mustCreate(t, db, &cafe)
+			mustCreate(t, db, &platform)
+
+			w := testRequest(t, GetInvitations, nil, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("list status = %d, body %s", w.Code, w.Body)
+			}
+			var seen []models.Invitation
+			if err := json.Unmarshal(w.Body.Bytes(), &seen); err != nil {
+				t.Fatal(err)
+			}
+			if len(seen) != tt.wantSeen {
+				t.Errorf("saw %d invitations, want %d", len(seen), tt.wantSeen)
+			}
+
+			params := gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(platform.ID), 10)}}
+			w = testRequest(t, RevokeInvitation, params, nil)
+			if w.Code != tt.wantRevoke {
+				t.Errorf("revoke status = %d, want %d, body %s", w.Code, tt.wantRevoke, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/events"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// KDSTicket is an open order's unserved lines at one station.
+type KDSTicket struct {
+	OrderID    uint               `json:"order_id"`
+	TableID    uint               `json:"table_id"`
+	TableName  string             `json:"table_name"`
+	WaiterID   *uint              `json:"waiter_id,omitempty"`
+	Notes      string             `json:"notes"`
+	OpenedAt   time.Time          `json:"opened_at"`
+	AgeSeconds int64              `json:"age_seconds"`
+	Items      []models.OrderItem `json:"items"`
+}
+
+// GetKDSQueue returns the live queue for a station: one ticket per open order
+// with lines that have not been served yet, oldest first. A ticket's age is
+// that of its oldest line.
+func GetKDSQueue(c *gin.Context) {
+	station := models.Station(c.Param("station"))
+	if !station.Valid() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown station"})
+		return
+	}
+
+	openOrders := applyTenantScope(database.DB.Model(&models.Order{}), c).
+		Where("status NOT IN ?", models.ClosedOrderStatuses).
+		Select("id")
+
+	var items []models.OrderItem
+	if err := applyTenantScope(database.DB, c).
+		Where("station = ? AND status <> ? AND order_id IN (?)", station, models.ItemServed, openOrders).
+		Order("created_at, id").
+		Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch queue"})
+		return
+	}
+
+	var orderIDs []uint
+	seen := map[uint]bool{}
+	for _, item := range items {
+		if !seen[item.OrderID] {
+			seen[item.OrderID] = true
+			orderIDs = append(orderIDs, item.OrderID)
+		}
+	}
+
+	orders := map[uint]models.Order{}
+	if len(orderIDs) > 0 {
+		var found []models.Order
+		if err := database.DB.Preload("Table").Find(&found, orderIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch queue"})
+			return
+		}
+		for _, order := range found {
+			orders[order.ID] = order
+		}
+	}
+
+	// Items are sorted by age, so tickets come out in order of their oldest line
+	now := time.Now()
+	tickets := []KDSTicket{}
+	index := map[uint]int{}
+	for _, item := range items {
+		i, ok := index[item.OrderID]
+		if !ok {
+			order := orders[item.OrderID]
+			tickets = append(tickets, KDSTicket{
+				OrderID:    order.ID,
+				TableID:    order.TableID,
+				TableName:  order.Table.Name,
+				WaiterID:   order.WaiterID,
+				Notes:      order.Notes,
+				OpenedAt:   item.CreatedAt,
+				AgeSeconds: int64(now.Sub(item.CreatedAt).Seconds()),
+			})
+			i = len(tickets) - 1
+			index[item.OrderID] = i
+		}
+		tickets[i].Items = append(tickets[i].Items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"station": station,
+		"tickets": tickets,
+	})
+}
+
+// BumpKDSItem moves a line one step forward: queued, cooking, ready, served.
+func BumpKDSItem(c *gin.Context) {
+	moveKDSItem(c, true)
+}
+
+// RecallKDSItem moves a line one step back, bringing a bumped line back onto
+// the display.
+func RecallKDSItem(c *gin.Context) {
+	moveKDSItem(c, false)
+}
+
+func moveKDSItem(c *gin.Context, forward bool) {
+	station := models.Station(c.Param("station"))
+	if !station.Valid() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown station"})
+		return
+	}
+
+	var item models.OrderItem
+	var order models.Order
+	var orderStatus models.OrderStatus
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyTenantScope(forUpdate(tx), c).Where("station = ?", station).First(&item, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Item not found")
+		}
+
+		if err := forUpdate(tx).First(&order, item.OrderID).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Order not found")
+		}
+		orderStatus = order.Status
+		for _, closed := range models.ClosedOrderStatuses {
+			if order.Status == closed {
+				return abortTx(http.StatusConflict, "Order is "+string(order.Status))
+			}
+		}
+
+		next, ok := item.Status.Next()
+		if !forward {
+			next, ok = item.Status.Previous()
+		}
+		if !ok {
+			return abortTx(http.StatusConflict, "Item is already "+string(item.Status))
+		}
+
+		before := item
+		now := time.Now()
+		if err := tx.Model(&item).Updates(map[string]interface{}{
+			"status":            next,
+			"status_changed_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditUpdate, "order_item", item.ID, before, item); err != nil {
+			return err
+		}
+
+		return syncOrderStatus(tx, c, &order)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update item")
+		return
+	}
+	publish(c, events.OrderItemStatusChanged, item)
+	if order.Status != orderStatus {
+		publish(c, events.OrderStatusChanged, order)
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// syncOrderStatus moves a locked order forward to match its lines: preparing
+// once any line has been started, ready once every line is ready and served
+// once every line is served. It never moves an order backwards, so recalls
+// leave the order status alone.
+func syncOrderStatus(tx *gorm.DB, c *gin.Context, order *models.Order) error {
+	var statuses []models.OrderItemStatus
+	if err := tx.Model(&models.OrderItem{}).Where("order_id = ?", order.ID).Pluck("status", &statuses).Error; err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	started, ready, served := false, true, true
+	for _, status := range statuses {
+		if status != models.ItemQueued {
+			started = true
+		}
+		if status != models.ItemReady && status != models.ItemServed {
+			ready = false
+		}
+		if status != models.ItemServed {
+			served = false
+		}
+	}
+
+	var target models.OrderStatus
+	switch {
+	case served:
+		target = models.OrderServed
+	case ready:
+		target = models.OrderReady
+	case started:
+		target = models.OrderPreparing
+	default:
+		return nil
+	}
+	if target == order.Status || !order.Status.CanTransition(target) {
+		return nil
+	}
+
+	before := *order
+	updates, err := order.Transition(target, time.Now())
+	if err != nil {
+		return err
+	}
+	updates["updated_by_id"] = getActorID(c)
+	if err := tx.Model(order).Updates(updates).Error; err != nil {
+		return err
+	}
+	return recordAudit(tx, c, models.AuditUpdate, "order", order.ID, before, order)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// postLedger appends an entry to the customer's ledger and applies it to
+// the cached CreditBalance. Callers must hold a row lock on the customer and
+// run it inside the same transaction as the change that caused it. The
+// balance change is written to the audit log.
+func postLedger(tx *gorm.DB, c *gin.Context, customer *models.Customer, entry models.LedgerEntry) error {
+	if entry.Amount == 0 {
+		return nil
+	}
+
+	entry.CustomerID = customer.ID
+	entry.TenantID = customer.TenantID
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	before := *customer
+	balance := customer.CreditBalance.Add(entry.Amount)
+	if err := tx.Model(customer).Update("credit_balance", balance).Error; err != nil {
+		return err
+	}
+	customer.CreditBalance = balance
+	return recordAudit(tx, c, models.AuditUpdate, "customer", customer.ID, before, customer)
+}
+
+// LedgerStatementLine is a ledger entry with the balance after it was posted.
+type LedgerStatementLine struct {
+	models.LedgerEntry
+	Balance models.Money `json:"balance"`
+}
+
+// GetCustomerLedger returns the customer's statement with running balances.
+// Optional from/to query parameters (YYYY-MM-DD) limit the period; the
+// opening balance then carries everything posted before it.
+func GetCustomerLedger(c *gin.Context) {
+	id := c.Param("id")
+
+	var customer models.Customer
+	if err := applyTenantScope(database.DB, c).First(&customer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	query := database.DB.Where("customer_id = ?", customer.ID)
+
+	var opening models.Money
+	if from := c.Query("from"); from != "" {
+		start, err := parseBusinessDay(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+		if err := database.DB.Model(&models.LedgerEntry{}).
+			Where("customer_id = ? AND created_at < ?", customer.ID, start).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&opening).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+			return
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if to := c.Query("to"); to != "" {
+		end, err := parseBusinessDay(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+		query = query.Where("created_at < ?", end.AddDate(0, 0, 1))
+	}
+
+	var entries []models.LedgerEntry
+	if err := query.Order("created_at, id").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+
+	lines := make([]LedgerStatementLine, 0, len(entries))
+	balance := opening
+	for _, entry := range entries {
+		balance = balance.Add(entry.Amount)
+		lines = append(lines, LedgerStatementLine{LedgerEntry: entry, Balance: balance})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer_id":     customer.ID,
+		"name":            customer.Name,
+		"opening_balance": opening,
+		"closing_balance": balance,
+		"credit_balance":  customer.CreditBalance,
+		"entries":         lines,
+	})
+}
+
+// LedgerAdjustmentRequest posts a manual entry to a customer's ledger. An
+// adjustment's Amount is signed like the ledger: positive when the customer
+// owes more. A write-off's Amount is what is forgiven and is positive.
+type LedgerAdjustmentRequest struct {
+	Type   models.LedgerEntryType `json:"type" binding:"required"`
+	Amount models.Money           `json:"amount" binding:"required"`
+	Notes  string                 `json:"notes" binding:"required"`
+}
+
+// AdjustCustomerLedger corrects a customer's balance with an adjustment or
+// writes off part of what they owe. A write-off cannot exceed the balance.
+func AdjustCustomerLedger(c *gin.Context) {
+	var req LedgerAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch req.Type {
+	case models.LedgerAdjustment:
+	case models.LedgerWriteOff:
+		if req.Amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be adjustment or write_off"})
+		return
+	}
+
+	var entry models.LedgerEntry
+	var customer models.Customer
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyTenantScope(forUpdate(tx), c).First(&customer, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Customer not found")
+		}
+		if err := ensureDayOpen(tx, customer.TenantID, time.Now()); err != nil {
+			return err
+		}
+
+		entry = models.LedgerEntry{Type: req.Type, Amount: req.Amount, Notes: req.Notes}
+		if req.Type == models.LedgerWriteOff {
+			if req.Amount > customer.CreditBalance {
+				return abortTx(http.StatusBadRequest, "Only "+customer.CreditBalance.String()+" is owed")
+			}
+			entry.Amount = req.Amount.Neg()
+		}
+		return postLedger(tx, c, &customer, entry)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update customer balance")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"customer_id":    customer.ID,
+		"type":           entry.Type,
+		"amount":         entry.Amount,
+		"notes":          entry.Notes,
+		"credit_balance": customer.CreditBalance,
+	})
+}
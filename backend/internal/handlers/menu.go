@@ -7,6 +7,7 @@ import (
 	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetMenuItems(c *gin.Context) {
@@ -53,10 +54,29 @@ func CreateMenuItem(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Orders are priced from the menu, so a price of nothing or less would
+	// bill, or even credit, the customer wrongly
+	if menuItem.Price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price must be positive"})
+		return
+	}
+	if menuItem.Station == "" {
+		menuItem.Station = models.StationKitchen
+	}
+	if !menuItem.Station.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown station"})
+		return
+	}
 	// Assign tenant
 	menuItem.TenantID = getTenantID(c)
 
-	if err := database.DB.Create(&menuItem).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&menuItem).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "menu_item", menuItem.ID, nil, menuItem)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create menu item"})
 		return
 	}
@@ -80,6 +100,11 @@ func UpdateMenuItem(c *gin.Context) {
 		return
 	}
 
+	if updateData.Price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price must be positive"})
+		return
+	}
+
 	updates := map[string]interface{}{
 		"name":        updateData.Name,
 		"category":    updateData.Category,
@@ -87,8 +112,22 @@ func UpdateMenuItem(c *gin.Context) {
 		"description": updateData.Description,
 		"available":   updateData.Available,
 	}
+	if updateData.Station != "" {
+		if !updateData.Station.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown station"})
+			return
+		}
+		updates["station"] = updateData.Station
+	}
 
-	if err := database.DB.Model(&menuItem).Updates(updates).Error; err != nil {
+	before := menuItem
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&menuItem).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "menu_item", menuItem.ID, before, menuItem)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update menu item"})
 		return
 	}
@@ -98,9 +137,20 @@ func UpdateMenuItem(c *gin.Context) {
 
 func DeleteMenuItem(c *gin.Context) {
 	id := c.Param("id")
-	// Tenant scoping applied via applyTenantScope
-	if err := applyTenantScope(database.DB, c).Delete(&models.MenuItem{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete menu item"})
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Tenant scoping applied via applyTenantScope
+		var menuItem models.MenuItem
+		if err := applyTenantScope(forUpdate(tx), c).First(&menuItem, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Menu item not found")
+		}
+		if err := tx.Delete(&menuItem).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditDelete, "menu_item", menuItem.ID, menuItem, nil)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to delete menu item")
 		return
 	}
 
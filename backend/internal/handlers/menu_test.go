@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMenuPricesArePositive(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	item := models.MenuItem{TenantID: &tenantID, Name: "Tea", Category: "Drinks", Price: 5000, Available: true}
+	mustCreate(t, db, &item)
+	params := gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(item.ID), 10)}}
+
+	for _, price := range []models.Money{0, -5000} {
+		body := gin.H{"name": "Tea", "category": "Drinks", "price": price, "available": true}
+		if w := testRequest(t, CreateMenuItem, nil, body); w.Code != http.StatusBadRequest {
+			t.Errorf("create at %s: status = %d, want %d", price, w.Code, http.StatusBadRequest)
+		}
+		if w := testRequest(t, UpdateMenuItem, params, body); w.Code != http.StatusBadRequest {
+			t.Errorf("update to %s: status = %d, want %d", price, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	db.First(&item, item.ID)
+	if item.Price != 5000 {
+		t.Errorf("price = %s, want 50.00", item.Price)
+	}
+	body := gin.H{"name": "Tea", "category": "Drinks", "price": models.Money(6000), "available": true}
+	if w := testRequest(t, UpdateMenuItem, params, body); w.Code != http.StatusOK {
+		t.Errorf("update to 60.00: status = %d: %s", w.Code, w.Body)
+	}
+}
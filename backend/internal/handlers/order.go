@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/events"
 	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetOrders(c *gin.Context) {
 	var orders []models.Order
 	// Tenant scoping applied via applyTenantScope
-	query := applyTenantScope(database.DB, c).Preload("Table").Preload("Customer").Preload("Items")
+	query := applyTenantScope(database.DB, c).Preload("Table").Preload("Customer").Preload("Items").Preload("Waiter")
 
 	// Filter by status if provided
 	if status := c.Query("status"); status != "" {
@@ -29,6 +34,14 @@ func GetOrders(c *gin.Context) {
 		query = query.Where("customer_id = ?", customerID)
 	}
 
+	// Filter by responsible waiter or by who rang the order up
+	if waiterID := c.Query("waiter_id"); waiterID != "" {
+		query = query.Where("waiter_id = ?", waiterID)
+	}
+	if createdByID := c.Query("created_by_id"); createdByID != "" {
+		query = query.Where("created_by_id = ?", createdByID)
+	}
+
 	if err := query.Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
@@ -42,7 +55,7 @@ func GetOrder(c *gin.Context) {
 
 	var order models.Order
 	// Tenant scoping applied via applyTenantScope
-	if err := applyTenantScope(database.DB, c).Preload("Table").Preload("Customer").Preload("Items").First(&order, id).Error; err != nil {
+	if err := applyTenantScope(database.DB, c).Preload("Table").Preload("Customer").Preload("Items").Preload("Waiter").First(&order, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
@@ -50,43 +63,139 @@ func GetOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
+// OrderItemRequest references a menu item by ID. Name and price are always
+// read from the menu on the server; any client-sent price is ignored.
+type OrderItemRequest struct {
+	MenuItemID uint `json:"menu_item_id" binding:"required"`
+	Quantity   int  `json:"quantity"`
+}
+
+type CreateOrderRequest struct {
+	TableID    uint               `json:"table_id"`
+	CustomerID uint               `json:"customer_id"`
+	WaiterID   *uint              `json:"waiter_id"`
+	Items      []OrderItemRequest `json:"items" binding:"dive"`
+	Notes      string             `json:"notes"`
+}
+
+// resolveWaiter checks that the waiter is an active staff member of the
+// current cafe. Without an explicit waiter, the acting user is responsible.
+func resolveWaiter(c *gin.Context, waiterID *uint) (*uint, error) {
+	if waiterID == nil {
+		return getActorID(c), nil
+	}
+	var waiter models.User
+	if err := applyTenantScope(database.DB, c).Where("active = ?", true).First(&waiter, *waiterID).Error; err != nil {
+		return nil, fmt.Errorf("waiter %d not found", *waiterID)
+	}
+	return &waiter.ID, nil
+}
+
+// priceOrderItem builds an order line from the current menu entry, snapshotting
+// its name and price. Unavailable items and items from another cafe are rejected.
+func priceOrderItem(c *gin.Context, req OrderItemRequest) (models.OrderItem, error) {
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		return models.OrderItem{}, fmt.Errorf("quantity must be positive")
+	}
+
+	tenantID := getTenantID(c)
+
+	var menuItem models.MenuItem
+	if err := applyTenantScope(database.DB, c).First(&menuItem, req.MenuItemID).Error; err != nil {
+		return models.OrderItem{}, fmt.Errorf("menu item %d not found", req.MenuItemID)
+	}
+	if menuItem.TenantID != nil && (tenantID == nil || *menuItem.TenantID != *tenantID) {
+		return models.OrderItem{}, fmt.Errorf("menu item %d not found", req.MenuItemID)
+	}
+	if !menuItem.Available {
+		return models.OrderItem{}, fmt.Errorf("menu item %q is not available", menuItem.Name)
+	}
+
+	item := models.OrderItem{
+		TenantID:    tenantID,
+		MenuItemID:  &menuItem.ID,
+		ItemName:    menuItem.Name,
+		Quantity:    req.Quantity,
+		Price:       menuItem.Price,
+		CreatedByID: getActorID(c),
+		Station:     menuItem.Station,
+		Status:      models.ItemQueued,
+		Category:    menuItem.Category,
+	}
+	item.Subtotal = item.Price.Mul(item.Quantity)
+	return item, nil
+}
+
 func CreateOrder(c *gin.Context) {
-	var order models.Order
-	if err := c.ShouldBindJSON(&order); err != nil {
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Calculate total
-	var total float64
-	for _, item := range order.Items {
-		total += item.Subtotal
+	waiterID, err := resolveWaiter(c, req.WaiterID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	order.Total = total
-	order.Status = models.OrderPending
 
-	// Assign tenant to order and items
-	tenantID := getTenantID(c)
-	order.TenantID = tenantID
-	for i := range order.Items {
-		order.Items[i].TenantID = tenantID
+	order := models.Order{
+		TableID:     req.TableID,
+		CustomerID:  req.CustomerID,
+		Notes:       req.Notes,
+		Status:      models.OrderPending,
+		CreatedByID: getActorID(c),
+		UpdatedByID: getActorID(c),
+		WaiterID:    waiterID,
 	}
-	if err := database.DB.Create(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
-		return
+
+	// Price every line from the menu
+	for _, itemReq := range req.Items {
+		item, err := priceOrderItem(c, itemReq)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		order.Items = append(order.Items, item)
 	}
 
-	// Update customer credit balance if order status is billed
-	if order.Status == models.OrderBilled {
+	// Assign tenant to order
+	order.TenantID = getTenantID(c)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// The table and customer must be the cafe's own; shared rows are
+		// not billed to
+		var table models.Table
+		if err := strictTenantScope(tx, c).First(&table, order.TableID).Error; err != nil {
+			return abortTx(http.StatusBadRequest, fmt.Sprintf("table %d not found", order.TableID))
+		}
 		var customer models.Customer
-		if err := database.DB.First(&customer, order.CustomerID).Error; err == nil {
-			customer.CreditBalance += order.Total
-			database.DB.Save(&customer)
+		if err := strictTenantScope(tx, c).First(&customer, order.CustomerID).Error; err != nil {
+			return abortTx(http.StatusBadRequest, fmt.Sprintf("customer %d not found", order.CustomerID))
+		}
+
+		// Work out tax, service charge and total with the cafe's settings
+		cfg, err := loadTaxConfig(tx, order.TenantID)
+		if err != nil {
+			return err
+		}
+		order.Price(order.Items, cfg)
+
+		if err := tx.Create(&order).Error; err != nil {
+			return err
 		}
+		return recordAudit(tx, c, models.AuditCreate, "order", order.ID, nil, order)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to create order")
+		return
 	}
 
 	// Load relationships
-	database.DB.Preload("Table").Preload("Customer").Preload("Items").First(&order, order.ID)
+	database.DB.Preload("Table").Preload("Customer").Preload("Items").Preload("Waiter").First(&order, order.ID)
+	publish(c, events.OrderCreated, order)
 
 	c.JSON(http.StatusCreated, order)
 }
@@ -94,19 +203,10 @@ func CreateOrder(c *gin.Context) {
 func UpdateOrder(c *gin.Context) {
 	id := c.Param("id")
 
-	var order models.Order
-	// Tenant scoping applied via applyTenantScope
-	if err := applyTenantScope(database.DB, c).Preload("Items").First(&order, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-		return
-	}
-
-	oldStatus := order.Status
-	oldTotal := order.Total
-
 	var updateData struct {
-		Status models.OrderStatus `json:"status"`
-		Notes  string             `json:"notes"`
+		Status   models.OrderStatus `json:"status"`
+		Notes    string             `json:"notes"`
+		WaiterID *uint              `json:"waiter_id"`
 	}
 
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -114,35 +214,125 @@ func UpdateOrder(c *gin.Context) {
 		return
 	}
 
-	updates := map[string]interface{}{
-		"status": updateData.Status,
-		"notes":  updateData.Notes,
-	}
+	var order models.Order
+	var oldStatus models.OrderStatus
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Tenant scoping applied via applyTenantScope
+		if err := applyTenantScope(forUpdate(tx), c).First(&order, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Order not found")
+		}
 
-	if err := database.DB.Model(&order).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
-		return
-	}
+		before := order
+		oldStatus = order.Status
 
-	// If order status changed to billed, update customer credit
-	if oldStatus != models.OrderBilled && updateData.Status == models.OrderBilled {
-		var customer models.Customer
-		if err := database.DB.First(&customer, order.CustomerID).Error; err == nil {
-			customer.CreditBalance += oldTotal
-			database.DB.Save(&customer)
+		updates := map[string]interface{}{
+			"notes":         updateData.Notes,
+			"updated_by_id": getActorID(c),
+		}
+		if updateData.Status != "" && updateData.Status != order.Status {
+			// Billing and voiding move money, so waiters cannot do them here
+			if updateData.Status == models.OrderBilled || updateData.Status == models.OrderVoid {
+				if !models.UserRole(c.GetString("role")).Can(models.PermOrderSettle) {
+					return abortTx(http.StatusForbidden, "Permission denied")
+				}
+			}
+			// Billing counts towards today and voiding takes a bill back off
+			// the day it was billed, so neither may touch a closed day
+			if updateData.Status == models.OrderBilled {
+				if err := ensureDayOpen(tx, order.TenantID, time.Now()); err != nil {
+					return err
+				}
+			}
+			if updateData.Status == models.OrderVoid && order.BilledAt != nil {
+				if err := ensureDayOpen(tx, order.TenantID, *order.BilledAt); err != nil {
+					return err
+				}
+			}
+			statusUpdates, err := order.Transition(updateData.Status, time.Now())
+			if errors.Is(err, models.ErrUnknownOrderStatus) {
+				return abortTx(http.StatusBadRequest, err.Error())
+			}
+			if err != nil {
+				return abortTx(http.StatusConflict, err.Error())
+			}
+			for column, value := range statusUpdates {
+				updates[column] = value
+			}
+		}
+		if updateData.WaiterID != nil {
+			waiterID, err := resolveWaiter(c, updateData.WaiterID)
+			if err != nil {
+				return abortTx(http.StatusBadRequest, err.Error())
+			}
+			updates["waiter_id"] = waiterID
+		}
+
+		if err := tx.Model(&order).Updates(updates).Error; err != nil {
+			return abortTx(http.StatusInternalServerError, "Failed to update order")
+		}
+		if err := recordAudit(tx, c, models.AuditUpdate, "order", order.ID, before, order); err != nil {
+			return err
+		}
+
+		if err := postOrderCredit(tx, c, &order, oldStatus); err != nil {
+			return err
+		}
+		if order.Status == models.OrderBilled && oldStatus != models.OrderBilled {
+			return invoiceOrder(tx, order)
 		}
+		return nil
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update order")
+		return
 	}
 
-	database.DB.Preload("Table").Preload("Customer").Preload("Items").First(&order, id)
+	database.DB.Preload("Table").Preload("Customer").Preload("Items").Preload("Waiter").First(&order, order.ID)
+	if order.Status != oldStatus {
+		publish(c, events.OrderStatusChanged, order)
+	}
 
 	c.JSON(http.StatusOK, order)
 }
 
 func DeleteOrder(c *gin.Context) {
 	id := c.Param("id")
-	// Tenant scoping applied via applyTenantScope
-	if err := applyTenantScope(database.DB, c).Delete(&models.Order{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete order"})
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Tenant scoping applied via applyTenantScope
+		var order models.Order
+		if err := applyTenantScope(forUpdate(tx), c).First(&order, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Order not found")
+		}
+		// Only orders that never reached a customer's balance, or whose
+		// charge was reversed by voiding, can go; billed orders are voided
+		switch order.Status {
+		case models.OrderPending, models.OrderCancelled, models.OrderVoid:
+		case models.OrderBilled:
+			return abortTx(http.StatusConflict, "Billed orders are voided, not deleted")
+		default:
+			return abortTx(http.StatusConflict, fmt.Sprintf("Cannot delete a %s order; cancel it first", order.Status))
+		}
+		var payments int64
+		if err := tx.Model(&models.Payment{}).Where("order_id = ?", order.ID).Count(&payments).Error; err != nil {
+			return err
+		}
+		if payments > 0 {
+			return abortTx(http.StatusConflict, "Order has payments and cannot be deleted")
+		}
+
+		// Record who deleted it before the soft delete
+		before := order
+		if err := tx.Model(&order).Update("updated_by_id", getActorID(c)).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&order).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditDelete, "order", order.ID, before, nil)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to delete order")
 		return
 	}
 
@@ -152,40 +342,110 @@ func DeleteOrder(c *gin.Context) {
 func AddOrderItem(c *gin.Context) {
 	orderID := c.Param("id")
 
-	var item models.OrderItem
-	if err := c.ShouldBindJSON(&item); err != nil {
+	var req OrderItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Verify order exists
-	// Tenant scoping applied via applyTenantScope
-	var order models.Order
-	if err := applyTenantScope(database.DB, c).First(&order, orderID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	item, err := priceOrderItem(c, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	item.OrderID = order.ID
-	item.Subtotal = float64(item.Quantity) * item.Price
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Verify order exists
+		// Tenant scoping applied via applyTenantScope
+		var order models.Order
+		if err := applyTenantScope(forUpdate(tx), c).First(&order, orderID).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Order not found")
+		}
+		for _, closed := range models.ClosedOrderStatuses {
+			if order.Status == closed {
+				return abortTx(http.StatusConflict, fmt.Sprintf("Cannot add items to a %s order", order.Status))
+			}
+		}
 
-	// Assign tenant to item
-	item.TenantID = getTenantID(c)
-	if err := database.DB.Create(&item).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add item"})
-		return
-	}
+		item.OrderID = order.ID
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditCreate, "order_item", item.ID, nil, item); err != nil {
+			return err
+		}
 
-	// Update order total
-	var items []models.OrderItem
-	database.DB.Where("order_id = ?", order.ID).Find(&items)
-	
-	var total float64
-	for _, i := range items {
-		total += i.Subtotal
+		// Update the order's breakdown and total
+		before := order
+		if err := repriceOrder(tx, &order); err != nil {
+			return err
+		}
+		if err := tx.Model(&order).Update("updated_by_id", getActorID(c)).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "order", order.ID, before, order)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to add item")
+		return
 	}
 
-	database.DB.Model(&order).Update("total", total)
+	publish(c, events.OrderItemAdded, item)
 
 	c.JSON(http.StatusCreated, item)
 }
+
+// postOrderCredit applies the credit effect of an order's status change:
+// billing charges the order's customer what is left to pay on it after any
+// payments taken against it, and voiding a billed order reverses whatever
+// was charged for it. Other transitions have no effect on balances.
+func postOrderCredit(tx *gorm.DB, c *gin.Context, order *models.Order, from models.OrderStatus) error {
+	switch {
+	case order.Status == models.OrderBilled && from != models.OrderBilled:
+		var customer models.Customer
+		if err := cafeScope(forUpdate(tx), order.TenantID).First(&customer, order.CustomerID).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Customer not found")
+		}
+		return postLedger(tx, c, &customer, models.LedgerEntry{
+			Type:    models.LedgerCharge,
+			Amount:  order.Due(),
+			OrderID: &order.ID,
+		})
+
+	case order.Status == models.OrderVoid && from == models.OrderBilled:
+		// Charges may have gone to the table's customer rather than the
+		// order's, so reverse them per charged customer
+		type customerCharge struct {
+			CustomerID uint
+			Total      models.Money
+		}
+		var charged []customerCharge
+		if err := tx.Model(&models.LedgerEntry{}).
+			Where("order_id = ? AND type = ?", order.ID, models.LedgerCharge).
+			Select("customer_id, COALESCE(SUM(amount), 0) AS total").
+			Group("customer_id").
+			Scan(&charged).Error; err != nil {
+			return err
+		}
+		// Orders billed before the ledger existed have no entries, and
+		// neither do orders paid in full before they were billed
+		if len(charged) == 0 && order.Due() > 0 {
+			charged = append(charged, customerCharge{order.CustomerID, order.Due()})
+		}
+		for _, ch := range charged {
+			var customer models.Customer
+			if err := cafeScope(forUpdate(tx), order.TenantID).First(&customer, ch.CustomerID).Error; err != nil {
+				return abortTx(http.StatusNotFound, "Customer not found")
+			}
+			if err := postLedger(tx, c, &customer, models.LedgerEntry{
+				Type:    models.LedgerAdjustment,
+				Amount:  ch.Total.Neg(),
+				OrderID: &order.ID,
+				Notes:   fmt.Sprintf("Order #%d voided", order.ID),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
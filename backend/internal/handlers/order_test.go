@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateOrderRequiresCafeTableAndCustomer(t *testing.T) {
+	tests := []struct {
+		name          string
+		otherTable    bool
+		otherCustomer bool
+		want          int
+	}{
+		{"own table and customer", false, false, http.StatusCreated},
+		{"another cafe's table", true, false, http.StatusBadRequest},
+		{"another cafe's customer", false, true, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			mustCreate(t, db, &models.Cafe{ID: testTenantID, Name: "Altia", Subdomain: "altia"})
+			tenantID, otherID := testTenantID, testTenantID+1
+			table := models.Table{TenantID: &tenantID, Name: "T1", Status: models.TableOccupied}
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			if tt.otherTable {
+				table.TenantID = &otherID
+			}
+			if tt.otherCustomer {
+				customer.TenantID = &otherID
+			}
+			mustCreate(t, db, &table)
+			mustCreate(t, db, &customer)
+
+			w := testRequest(t, CreateOrder, nil, gin.H{"table_id": table.ID, "customer_id": customer.ID})
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.want, w.Body)
+			}
+			var orders int64
+			db.Model(&models.Order{}).Count(&orders)
+			if created := tt.want == http.StatusCreated; (orders == 1) != created {
+				t.Errorf("%d orders stored, want created %v", orders, created)
+			}
+		})
+	}
+}
+
+func TestBillingChargesOnlyTheCafesCustomer(t *testing.T) {
+	db := testDB(t)
+	staff(t, db)
+	tenantID, otherID := testTenantID, testTenantID+1
+	other := models.Customer{TenantID: &otherID, Name: "Elsewhere"}
+	mustCreate(t, db, &other)
+	table := models.Table{TenantID: &tenantID, Name: "T1", Status: models.TableOccupied}
+	mustCreate(t, db, &table)
+	order := models.Order{TenantID: &tenantID, TableID: table.ID, CustomerID: other.ID, Status: models.OrderServed, Subtotal: 10000, Total: 10000}
+	mustCreate(t, db, &order)
+
+	w := testRequest(t, UpdateOrder, orderParams(order), gin.H{"status": models.OrderBilled})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d, body %s", w.Code, http.StatusNotFound, w.Body)
+	}
+	if err := db.First(&other, other.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if other.CreditBalance != 0 {
+		t.Errorf("other cafe's customer was charged %s", other.CreditBalance)
+	}
+}
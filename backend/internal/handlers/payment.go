@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/events"
 	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetPayments(c *gin.Context) {
@@ -19,6 +23,11 @@ func GetPayments(c *gin.Context) {
 		query = query.Where("customer_id = ?", customerID)
 	}
 
+	// Filter by the staff member who took the payment
+	if createdByID := c.Query("created_by_id"); createdByID != "" {
+		query = query.Where("created_by_id = ?", createdByID)
+	}
+
 	if err := query.Order("created_at DESC").Find(&payments).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
 		return
@@ -32,7 +41,7 @@ func GetPayment(c *gin.Context) {
 
 	var payment models.Payment
 	// Tenant scoping applied via applyTenantScope
-	if err := applyTenantScope(database.DB, c).Preload("Customer").Preload("Order").First(&payment, id).Error; err != nil {
+	if err := applyTenantScope(database.DB, c).Preload("Customer").Preload("Order").Preload("Refunds").First(&payment, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
 	}
@@ -46,77 +55,304 @@ func CreatePayment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Verify customer exists
-	var customer models.Customer
-	if err := database.DB.First(&customer, payment.CustomerID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+	if payment.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
 		return
 	}
+	// Refunds are only made through RefundPayment
+	payment.RefundOfID = nil
+	payment.Reason = ""
 
-	// Create payment record
-	// Assign tenant
-	payment.TenantID = getTenantID(c)
-	if err := database.DB.Create(&payment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
-		return
-	}
-
-	// Update customer credit balance (subtract payment amount)
-	customer.CreditBalance -= payment.Amount
-	if customer.CreditBalance < 0 {
-		customer.CreditBalance = 0
-	}
+	var raised pendingEvents
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Verify customer exists and lock it for the balance update
+		var customer models.Customer
+		if err := strictTenantScope(forUpdate(tx), c).First(&customer, payment.CustomerID).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Customer not found")
+		}
 
-	if err := database.DB.Save(&customer).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer balance"})
-		return
-	}
+		if err := ensureDayOpen(tx, getTenantID(c), time.Now()); err != nil {
+			return err
+		}
 
-	// If payment is linked to an order, update order status
-	if payment.OrderID != nil {
+		// A payment against an order that is not billed yet is held against
+		// the order, and billing charges only what it leaves to pay
 		var order models.Order
-		if err := database.DB.First(&order, *payment.OrderID).Error; err == nil {
-			// Check if order is fully paid
-			var totalPaid float64
-			database.DB.Model(&models.Payment{}).
-				Where("tenant_id = ? AND order_id = ?", getTenantString(c), *payment.OrderID).
-				Select("COALESCE(SUM(amount), 0)").
-				Scan(&totalPaid)
-
-			if totalPaid >= order.Total {
-				order.Status = models.OrderBilled
-				database.DB.Save(&order)
+		prepaid := false
+		if payment.OrderID != nil {
+			if err := applyTenantScope(forUpdate(tx), c).First(&order, *payment.OrderID).Error; err != nil {
+				return abortTx(http.StatusNotFound, "Order not found")
+			}
+			// The order is marked paid by what reaches the customer's
+			// account, so both must be the same customer's
+			if order.CustomerID != payment.CustomerID {
+				return abortTx(http.StatusBadRequest, "The order belongs to another customer")
+			}
+			switch order.Status {
+			case models.OrderCancelled, models.OrderVoid:
+				return abortTx(http.StatusConflict, fmt.Sprintf("Cannot take a payment against a %s order", order.Status))
+			case models.OrderBilled:
+			default:
+				if payment.Amount > order.Due() {
+					return abortTx(http.StatusBadRequest, "Only "+order.Due().String()+" is due on the order")
+				}
+				prepaid = true
+			}
+		}
+
+		// Create payment record
+		// Assign tenant, the staff member taking the payment and their drawer
+		payment.TenantID = getTenantID(c)
+		payment.CreatedByID = getActorID(c)
+		payment.UpdatedByID = getActorID(c)
+		sessionID, err := userCashSession(tx, payment.CreatedByID)
+		if err != nil {
+			return err
+		}
+		payment.CashSessionID = sessionID
+		if err := tx.Create(&payment).Error; err != nil {
+			return abortTx(http.StatusInternalServerError, "Failed to create payment")
+		}
+		if err := recordAudit(tx, c, models.AuditCreate, "payment", payment.ID, nil, payment); err != nil {
+			return err
+		}
+
+		// If payment is linked to an order, update what has been paid on it
+		// and bill it once it is paid in full
+		var billed *models.Order
+		if payment.OrderID != nil {
+			if err := syncOrderPaid(tx, &order); err != nil {
+				return err
+			}
+			if prepaid && order.Due() == 0 && order.Status.CanTransition(models.OrderBilled) {
+				before := order
+				updates, err := order.Transition(models.OrderBilled, time.Now())
+				if err != nil {
+					return err
+				}
+				updates["updated_by_id"] = getActorID(c)
+				if err := tx.Model(&order).Updates(updates).Error; err != nil {
+					return err
+				}
+				if err := recordAudit(tx, c, models.AuditUpdate, "order", order.ID, before, order); err != nil {
+					return err
+				}
+				if err := postOrderCredit(tx, c, &order, before.Status); err != nil {
+					return err
+				}
+				raised.add(events.OrderStatusChanged, order)
+				billed = &order
+			}
+		}
+
+		// Reduce customer credit balance by the payment, never below zero
+		settled := payment.Amount
+		if prepaid {
+			settled = 0
+		}
+		if settled > customer.CreditBalance {
+			settled = customer.CreditBalance
+		}
+		if settled > 0 {
+			if err := postLedger(tx, c, &customer, models.LedgerEntry{
+				Type:      models.LedgerPayment,
+				Amount:    settled.Neg(),
+				OrderID:   payment.OrderID,
+				PaymentID: &payment.ID,
+				Notes:     payment.Notes,
+			}); err != nil {
+				return abortTx(http.StatusInternalServerError, "Failed to update customer balance")
 			}
 		}
+
+		if billed != nil {
+			if err := invoiceOrder(tx, *billed); err != nil {
+				return err
+			}
+		}
+		return invoicePayment(tx, payment)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to create payment")
+		return
 	}
 
 	database.DB.Preload("Customer").Preload("Order").First(&payment, payment.ID)
+	publish(c, events.PaymentRecorded, payment)
+	raised.publish(c)
 
 	c.JSON(http.StatusCreated, payment)
 }
 
-func DeletePayment(c *gin.Context) {
-	id := c.Param("id")
+// syncOrderPaid recomputes what has been paid against an order, net of
+// refunds, and stamps PaidAt once the payments cover the total or clears it
+// when they no longer do. The caller must hold a row lock on the order.
+func syncOrderPaid(tx *gorm.DB, order *models.Order) error {
+	var paid models.Money
+	if err := tx.Model(&models.Payment{}).
+		Where("order_id = ?", order.ID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&paid).Error; err != nil {
+		return err
+	}
 
-	var payment models.Payment
-	// Tenant scoping applied via applyTenantScope
-	if err := applyTenantScope(database.DB, c).First(&payment, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
-		return
+	paidAt := order.PaidAt
+	switch covered := paid > 0 && paid >= order.Total; {
+	case covered && paidAt == nil:
+		now := time.Now()
+		paidAt = &now
+	case !covered:
+		paidAt = nil
+	}
+	if paid == order.AmountPaid && paidAt == order.PaidAt {
+		return nil
 	}
+	order.AmountPaid = paid
+	order.PaidAt = paidAt
+	return tx.Model(order).Select("amount_paid", "paid_at").Updates(order).Error
+}
 
-	// Restore customer credit balance before deleting
-	var customer models.Customer
-	if err := database.DB.First(&customer, payment.CustomerID).Error; err == nil {
-		customer.CreditBalance += payment.Amount
-		database.DB.Save(&customer)
+type RefundRequest struct {
+	// Amount defaults to whatever of the payment is not yet refunded
+	Amount *models.Money `json:"amount"`
+	Reason string        `json:"reason" binding:"required"`
+}
+
+// RefundPayment gives back part or all of a payment. The refund is a new
+// negative payment in the same method, linked to the original, which is
+// kept as it was. What the original took off the customer's balance is put
+// back, after first refunding any of it that exceeded what they owed, and
+// the order it paid for is no longer paid in full.
+func RefundPayment(c *gin.Context) {
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	if req.Amount != nil && *req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+
+	var refund models.Payment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := applyTenantScope(forUpdate(tx), c).First(&payment, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Payment not found")
+		}
+		if payment.RefundOfID != nil || payment.Amount <= 0 {
+			return abortTx(http.StatusConflict, "A refund cannot be refunded")
+		}
+		if err := ensureDayOpen(tx, payment.TenantID, time.Now()); err != nil {
+			return err
+		}
+
+		var refunded models.Money
+		if err := tx.Model(&models.Payment{}).
+			Where("refund_of_id = ?", payment.ID).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&refunded).Error; err != nil {
+			return err
+		}
+		refunded = refunded.Neg()
+		left := payment.Amount.Sub(refunded)
+		if left <= 0 {
+			return abortTx(http.StatusConflict, "Payment is already fully refunded")
+		}
+		amount := left
+		if req.Amount != nil {
+			amount = *req.Amount
+		}
+		if amount > left {
+			return abortTx(http.StatusBadRequest, "Only "+left.String()+" of the payment can be refunded")
+		}
 
-	if err := database.DB.Delete(&payment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payment"})
+		sessionID, err := refundCashSession(tx, c, payment)
+		if err != nil {
+			return err
+		}
+		refund = models.Payment{
+			TenantID:      payment.TenantID,
+			CustomerID:    payment.CustomerID,
+			OrderID:       payment.OrderID,
+			Amount:        amount.Neg(),
+			Method:        payment.Method,
+			CashSessionID: sessionID,
+			RefundOfID:    &payment.ID,
+			Reason:        req.Reason,
+			CreatedByID:   getActorID(c),
+			UpdatedByID:   getActorID(c),
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditCreate, "payment", refund.ID, nil, refund); err != nil {
+			return err
+		}
+
+		// The part of the payment that exceeded the balance never reached
+		// the ledger, so it is refunded first without touching the balance
+		var customer models.Customer
+		if err := cafeScope(forUpdate(tx), payment.TenantID).First(&customer, payment.CustomerID).Error; err == nil {
+			var posted struct {
+				Count int64
+				Total models.Money
+			}
+			if err := tx.Model(&models.LedgerEntry{}).
+				Where("payment_id = ?", payment.ID).
+				Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS total").
+				Scan(&posted).Error; err != nil {
+				return err
+			}
+			// Payments recorded before the ledger existed have no entries,
+			// and neither do payments taken before their order was billed;
+			// those only came off the balance if billing has charged less
+			// for them since
+			settled := posted.Total.Neg()
+			if posted.Count == 0 {
+				settled = payment.Amount
+				if payment.OrderID != nil {
+					var order models.Order
+					if err := tx.Select("status").First(&order, *payment.OrderID).Error; err == nil && order.Status != models.OrderBilled {
+						settled = 0
+					}
+				}
+			}
+			unsettled := payment.Amount.Sub(settled)
+			restored := refunded.Add(amount).Sub(unsettled)
+			if already := refunded.Sub(unsettled); already > 0 {
+				restored = restored.Sub(already)
+			}
+			if restored > 0 {
+				if err := postLedger(tx, c, &customer, models.LedgerEntry{
+					Type:      models.LedgerRefund,
+					Amount:    restored,
+					OrderID:   payment.OrderID,
+					PaymentID: &refund.ID,
+					Notes:     fmt.Sprintf("Refund of payment #%d: %s", payment.ID, req.Reason),
+				}); err != nil {
+					return abortTx(http.StatusInternalServerError, "Failed to update customer balance")
+				}
+			}
+		}
+
+		if payment.OrderID != nil {
+			var order models.Order
+			if err := forUpdate(tx).First(&order, *payment.OrderID).Error; err == nil {
+				if err := syncOrderPaid(tx, &order); err != nil {
+					return err
+				}
+			}
+		}
+		return invoicePayment(tx, refund)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to refund payment")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Payment deleted successfully"})
+	database.DB.Preload("Customer").Preload("Order").First(&refund, refund.ID)
+	publish(c, events.PaymentRefunded, refund)
+
+	c.JSON(http.StatusCreated, refund)
 }
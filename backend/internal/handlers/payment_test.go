@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	testCashierID      uint = 2
+	testOtherCashierID uint = 3
+)
+
+// staff creates the test manager and two cashiers of the test cafe.
+func staff(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	tenantID := testTenantID
+	for _, u := range []models.User{
+		{ID: testUserID, Username: "manager", Role: models.RoleManager},
+		{ID: testCashierID, Username: "cashier", Role: models.RoleFrontdesk},
+		{ID: testOtherCashierID, Username: "cashier2", Role: models.RoleFrontdesk},
+	} {
+		u.TenantID = &tenantID
+		mustCreate(t, db, &u)
+	}
+}
+
+// openDrawer opens a cash session for userID on terminal with a float of
+// 100.00.
+func openDrawer(t *testing.T, db *gorm.DB, terminal models.Terminal, userID uint) models.CashSession {
+	t.Helper()
+	tenantID := testTenantID
+	session := models.CashSession{
+		TenantID:     &tenantID,
+		TerminalID:   terminal.ID,
+		UserID:       userID,
+		Status:       models.CashSessionOpen,
+		OpenedAt:     time.Now().Add(-time.Hour),
+		OpeningFloat: 10000,
+	}
+	mustCreate(t, db, &session)
+	return session
+}
+
+// closeDrawer marks a cash session closed.
+func closeDrawer(t *testing.T, db *gorm.DB, session models.CashSession) {
+	t.Helper()
+	if err := db.Model(&session).Updates(map[string]interface{}{
+		"status":    models.CashSessionClosed,
+		"closed_at": time.Now(),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// takePayment records a cash payment of amount for customer as userID.
+func takePayment(t *testing.T, userID uint, customer models.Customer, amount models.Money) models.Payment {
+	t.Helper()
+	w := testRequestAs(t, userID, CreatePayment, nil, gin.H{"customer_id": customer.ID, "amount": amount, "method": "cash"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("payment status = %d, body %s", w.Code, w.Body)
+	}
+	var payment models.Payment
+	if err := json.Unmarshal(w.Body.Bytes(), &payment); err != nil {
+		t.Fatal(err)
+	}
+	return payment
+}
+
+func paymentParams(payment models.Payment) gin.Params {
+	return gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(payment.ID), 10)}}
+}
+
+func orderParams(order models.Order) gin.Params {
+	return gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(order.ID), 10)}}
+}
+
+func TestRefundPaidOutOfDrawer(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup arranges the drawers after the cashier took the payment in
+		// taken and returns the session the refund should come out of
+		setup func(t *testing.T, db *gorm.DB, terminal models.Terminal, taken models.CashSession) models.CashSession
+	}{
+		{"original drawer still open", func(t *testing.T, db *gorm.DB, terminal models.Terminal, taken models.CashSession) models.CashSession {
+			return taken
+		}},
+		{"next shift on the same terminal", func(t *testing.T, db *gorm.DB, terminal models.Terminal, taken models.CashSession) models.CashSession {
+			closeDrawer(t, db, taken)
+			return openDrawer(t, db, terminal, testOtherCashierID)
+		}},
+		{"refunding manager's drawer", func(t *testing.T, db *gorm.DB, terminal models.Terminal, taken models.CashSession) models.CashSession {
+			closeDrawer(t, db, taken)
+			other := models.Terminal{TenantID: taken.TenantID, Name: "Bar", TokenHash: "bar"}
+			mustCreate(t, db, &other)
+			return openDrawer(t, db, other, testUserID)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			staff(t, db)
+			tenantID := testTenantID
+			terminal := models.Terminal{TenantID: &tenantID, Name: "Till", TokenHash: "till"}
+			mustCreate(t, db, &terminal)
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+
+			taken := openDrawer(t, db, terminal, testCashierID)
+			payment := takePayment(t, testCashierID, customer, 5000)
+			if payment.CashSessionID == nil || *payment.CashSessionID != taken.ID {
+				t.Fatalf("payment cash session = %v, want %d", payment.CashSessionID, taken.ID)
+			}
+
+			want := tt.setup(t, db, terminal, taken)
+			before, err := expectedCash(db, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The manager refunds 20.00 of the 50.00
+			w := testRequestAs(t, testUserID, RefundPayment, paymentParams(payment), gin.H{"amount": models.Money(2000), "reason": "Cold coffee"})
+			if w.Code != http.StatusCreated {
+				t.Fatalf("refund status = %d, body %s", w.Code, w.Body)
+			}
+			var refund models.Payment
+			if err := json.Unmarshal(w.Body.Bytes(), &refund); err != nil {
+				t.Fatal(err)
+			}
+			if refund.CashSessionID == nil || *refund.CashSessionID != want.ID {
+				t.Fatalf("refund cash session = %v, want %d", refund.CashSessionID, want.ID)
+			}
+
+			after, err := expectedCash(db, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := after.Sub(before); got != -2000 {
+				t.Errorf("drawer changed by %s, want -20.00", got)
+			}
+		})
+	}
+}
+
+func TestRefundLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []*models.Money // refunds made in turn; nil refunds the rest
+		want    []int
+	}{
+		{"whole payment by default", []*models.Money{nil}, []int{http.StatusCreated}},
+		{"in parts up to the payment", []*models.Money{money(3000), money(2000)}, []int{http.StatusCreated, http.StatusCreated}},
+		{"more than the payment", []*models.Money{money(5001)}, []int{http.StatusBadRequest}},
+		{"more than is left", []*models.Money{money(3000), money(2001)}, []int{http.StatusCreated, http.StatusBadRequest}},
+		{"after a full refund", []*models.Money{nil, money(1)}, []int{http.StatusCreated, http.StatusConflict}},
+		{"zero amount", []*models.Money{money(0)}, []int{http.StatusBadRequest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID := testTenantID
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+			payment := takePayment(t, testUserID, customer, 5000)
+
+			for i, amount := range tt.amounts {
+				body := gin.H{"reason": "Returned"}
+				if amount != nil {
+					body["amount"] = *amount
+				}
+				w := testRequest(t, RefundPayment, paymentParams(payment), body)
+				if w.Code != tt.want[i] {
+					t.Fatalf("refund %d status = %d, want %d, body %s", i, w.Code, tt.want[i], w.Body)
+				}
+			}
+
+			var refunded models.Money
+			db.Model(&models.Payment{}).Where("refund_of_id = ?", payment.ID).Select("COALESCE(SUM(amount), 0)").Scan(&refunded)
+			if refunded < -payment.Amount {
+				t.Errorf("refunded %s of a %s payment", refunded.Neg(), payment.Amount)
+			}
+		})
+	}
+}
+
+func TestRefundOfRefundRejected(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	mustCreate(t, db, &customer)
+	payment := takePayment(t, testUserID, customer, 5000)
+
+	w := testRequest(t, RefundPayment, paymentParams(payment), gin.H{"amount": models.Money(1000), "reason": "Returned"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("refund status = %d, body %s", w.Code, w.Body)
+	}
+	var refund models.Payment
+	if err := json.Unmarshal(w.Body.Bytes(), &refund); err != nil {
+		t.Fatal(err)
+	}
+	w = testRequest(t, RefundPayment, paymentParams(refund), gin.H{"reason": "Again"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("refund of refund status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func money(m models.Money) *models.Money {
+	return &m
+}
+
+func TestSyncOrderPaid(t *testing.T) {
+	tests := []struct {
+		name        string
+		total       models.Money
+		payments    []models.Money
+		wantPaid    models.Money
+		wantPaidSet bool
+	}{
+		{"nothing paid", 10000, nil, 0, false},
+		{"part paid", 10000, []models.Money{4000}, 4000, false},
+		{"paid in full", 10000, []models.Money{4000, 6000}, 10000, true},
+		{"overpaid", 10000, []models.Money{12000}, 12000, true},
+		{"refunded below the total", 10000, []models.Money{10000, -2000}, 8000, false},
+		{"refunded in full", 10000, []models.Money{10000, -10000}, 0, false},
+		{"free order", 0, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID := testTenantID
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+			_, orders := seatTable(t, db, &customer, tt.total)
+			order := orders[0]
+
+			// Sync after each payment, as the handlers do
+			for _, amount := range tt.payments {
+				mustCreate(t, db, &models.Payment{TenantID: &tenantID, CustomerID: customer.ID, OrderID: &order.ID, Amount: amount})
+				if err := syncOrderPaid(db, &order); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := syncOrderPaid(db, &order); err != nil {
+				t.Fatal(err)
+			}
+
+			var stored models.Order
+			if err := db.First(&stored, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.AmountPaid != tt.wantPaid || order.AmountPaid != tt.wantPaid {
+				t.Errorf("amount_paid = %s (in memory %s), want %s", stored.AmountPaid, order.AmountPaid, tt.wantPaid)
+			}
+			if (stored.PaidAt != nil) != tt.wantPaidSet {
+				t.Errorf("paid_at = %v, want set %v", stored.PaidAt, tt.wantPaidSet)
+			}
+		})
+	}
+}
+
+func TestSyncOrderPaidKeepsPaidAt(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	mustCreate(t, db, &customer)
+	_, orders := seatTable(t, db, &customer, 10000)
+	order := orders[0]
+
+	mustCreate(t, db, &models.Payment{TenantID: &tenantID, CustomerID: customer.ID, OrderID: &order.ID, Amount: 10000})
+	if err := syncOrderPaid(db, &order); err != nil {
+		t.Fatal(err)
+	}
+	paidAt := order.PaidAt
+
+	// A tip on top leaves the order paid when it first was
+	mustCreate(t, db, &models.Payment{TenantID: &tenantID, CustomerID: customer.ID, OrderID: &order.ID, Amount: 500})
+	if err := syncOrderPaid(db, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.PaidAt == nil || !order.PaidAt.Equal(*paidAt) {
+		t.Errorf("paid_at = %v, want %v", order.PaidAt, paidAt)
+	}
+	if order.AmountPaid != 10500 {
+		t.Errorf("amount_paid = %s, want 105.00", order.AmountPaid)
+	}
+}
+
+func TestPrepaymentReducesCharge(t *testing.T) {
+	tests := []struct {
+		name     string
+		payments []models.Money // taken against the order before billing
+		refund   models.Money   // of the first payment, before billing
+		wantOwed models.Money
+	}{
+		{"nothing paid up front", nil, 0, 10000},
+		{"part paid up front", []models.Money{4000}, 0, 6000},
+		{"paid up front in parts", []models.Money{4000, 3000}, 0, 3000},
+		{"part refunded before billing", []models.Money{4000}, 1000, 7000},
+		{"paid in full up front", []models.Money{10000}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			staff(t, db)
+			tenantID := testTenantID
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+			_, orders := seatTable(t, db, &customer, 10000)
+			order := orders[0]
+
+			var first models.Payment
+			for i, amount := range tt.payments {
+				w := testRequest(t, CreatePayment, nil, gin.H{"customer_id": customer.ID, "order_id": order.ID, "amount": amount})
+				if w.Code != http.StatusCreated {
+					t.Fatalf("payment status = %d, body %s", w.Code, w.Body)
+				}
+				if i == 0 {
+					if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if tt.refund != 0 {
+				w := testRequest(t, RefundPayment, paymentParams(first), gin.H{"amount": tt.refund, "reason": "Changed order"})
+				if w.Code != http.StatusCreated {
+					t.Fatalf("refund status = %d, body %s", w.Code, w.Body)
+				}
+			}
+
+			// Paying in full bills the order; otherwise the manager bills it
+			if err := db.First(&order, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if order.Status != models.OrderBilled {
+				w := testRequest(t, UpdateOrder, orderParams(order), gin.H{"status": models.OrderBilled})
+				if w.Code != http.StatusOK {
+					t.Fatalf("bill status = %d, body %s", w.Code, w.Body)
+				}
+			}
+
+			if err := db.First(&customer, customer.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if customer.CreditBalance != tt.wantOwed {
+				t.Errorf("credit balance = %s, want %s", customer.CreditBalance, tt.wantOwed)
+			}
+		})
+	}
+}
+
+func TestPrepaymentLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		status models.OrderStatus
+		amount models.Money
+		want   int
+	}{
+		{"what is due", models.OrderServed, 10000, http.StatusCreated},
+		{"more than is due", models.OrderServed, 10001, http.StatusBadRequest},
+		{"more than is owed on a billed order", models.OrderBilled, 10001, http.StatusCreated},
+		{"cancelled order", models.OrderCancelled, 100, http.StatusConflict},
+		{"void order", models.OrderVoid, 100, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID := testTenantID
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+			_, orders := seatTable(t, db, &customer, 10000)
+			if err := db.Model(&orders[0]).Update("status", tt.status).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			w := testRequest(t, CreatePayment, nil, gin.H{"customer_id": customer.ID, "order_id": orders[0].ID, "amount": tt.amount})
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestPaymentAgainstAnotherCustomersOrder(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	ram := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	sita := models.Customer{TenantID: &tenantID, Name: "Sita"}
+	mustCreate(t, db, &ram)
+	mustCreate(t, db, &sita)
+	_, orders := seatTable(t, db, &ram, 10000)
+
+	w := testRequest(t, CreatePayment, nil, gin.H{"customer_id": sita.ID, "order_id": orders[0].ID, "amount": models.Money(10000)})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d, body %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+	var order models.Order
+	db.First(&order, orders[0].ID)
+	if order.AmountPaid != 0 || order.PaidAt != nil {
+		t.Errorf("order paid %s at %v, want nothing", order.AmountPaid, order.PaidAt)
+	}
+	var count int64
+	db.Model(&models.Payment{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d payments recorded, want 0", count)
+	}
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+	"altia-cafe-backend/internal/receipt"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultCafeName heads receipts of rows that belong to no cafe.
+const defaultCafeName = "Altia Cafe"
+
+// invoiceLockKey namespaces the advisory lock that serialises invoice
+// numbering within a cafe.
+const invoiceLockKey = int64(0x494e56) << 32
+
+// issueInvoice numbers a billed order or a payment with the cafe's next
+// invoice number and records what customerID owes as it stands, if given.
+// It must run in the transaction that bills the order or records the
+// payment, after every balance change in it. An order or payment is only
+// numbered once.
+func issueInvoice(tx *gorm.DB, tenantID *uint, customerID *uint, orderID, paymentID *uint) (models.Invoice, error) {
+	// Only one invoice is numbered per cafe at a time
+	var key int64 = invoiceLockKey
+	scope := tx.Model(&models.Invoice{}).Where("tenant_id IS NULL")
+	if tenantID != nil {
+		key |= int64(*tenantID)
+		scope = tx.Model(&models.Invoice{}).Where("tenant_id = ?", *tenantID)
+	}
+	if err := advisoryLock(tx, key); err != nil {
+		return models.Invoice{}, err
+	}
+	invoice, err := findInvoice(tx, orderID, paymentID)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return invoice, err
+	}
+
+	var balance models.Money
+	if customerID != nil {
+		if err := tx.Model(&models.Customer{}).Where("id = ?", *customerID).Select("credit_balance").Scan(&balance).Error; err != nil {
+			return invoice, err
+		}
+	}
+	var last uint
+	if err := scope.Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+		return invoice, err
+	}
+	invoice = models.Invoice{
+		TenantID:  tenantID,
+		Number:    last + 1,
+		OrderID:    orderID,
+		PaymentID:  paymentID,
+		CustomerID: customerID,
+		Balance:    balance,
+	}
+	return invoice, tx.Create(&invoice).Error
+}
+
+// findInvoice returns the invoice issued for an order or a payment.
+func findInvoice(tx *gorm.DB, orderID, paymentID *uint) (models.Invoice, error) {
+	var invoice models.Invoice
+	if orderID != nil {
+		return invoice, tx.Where("order_id = ?", *orderID).First(&invoice).Error
+	}
+	return invoice, tx.Where("payment_id = ?", *paymentID).First(&invoice).Error
+}
+
+// invoiceOrder issues the invoice of an order just billed, with the balance
+// of the customer it was charged to. A table payout can charge the table's
+// customer rather than the order's, and a split bill several customers, in
+// which case no balance is recorded.
+func invoiceOrder(tx *gorm.DB, order models.Order) error {
+	var charged []uint
+	if err := tx.Model(&models.LedgerEntry{}).
+		Where("order_id = ? AND type = ?", order.ID, models.LedgerCharge).
+		Distinct("customer_id").
+		Pluck("customer_id", &charged).Error; err != nil {
+		return err
+	}
+	// An order paid in full before billing was charged nothing
+	customerID := &order.CustomerID
+	switch len(charged) {
+	case 0:
+	case 1:
+		customerID = &charged[0]
+	default:
+		customerID = nil
+	}
+	_, err := issueInvoice(tx, order.TenantID, customerID, &order.ID, nil)
+	return err
+}
+
+// invoicePayment issues the receipt number of a payment just recorded.
+func invoicePayment(tx *gorm.DB, payment models.Payment) error {
+	_, err := issueInvoice(tx, payment.TenantID, &payment.CustomerID, nil, &payment.ID)
+	return err
+}
+
+// invoiceBill issues the invoices of orders billed together and then of the
+// payments made against them at the same time.
+func invoiceBill(tx *gorm.DB, orders []models.Order, paymentIDs []uint) error {
+	for _, order := range orders {
+		if err := invoiceOrder(tx, order); err != nil {
+			return err
+		}
+	}
+	if len(paymentIDs) == 0 {
+		return nil
+	}
+	var payments []models.Payment
+	if err := tx.Where("id IN ?", paymentIDs).Order("id").Find(&payments).Error; err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		if err := invoicePayment(tx, payment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiptCafeName returns the name printed at the top of a receipt.
+func receiptCafeName(tx *gorm.DB, tenantID *uint) string {
+	if tenantID != nil {
+		var cafe models.Cafe
+		if err := tx.First(&cafe, *tenantID).Error; err == nil && cafe.Name != "" {
+			return cafe.Name
+		}
+	}
+	return defaultCafeName
+}
+
+// staffName returns how a staff member is named on a receipt.
+func staffName(tx *gorm.DB, userID *uint) string {
+	if userID == nil {
+		return ""
+	}
+	var user models.User
+	if err := tx.First(&user, *userID).Error; err != nil {
+		return ""
+	}
+	if user.FullName != "" {
+		return user.FullName
+	}
+	return user.Username
+}
+
+// addOrder puts an order's lines and price breakdown on a receipt.
+func addOrder(r *receipt.Receipt, order models.Order) {
+	r.Table = order.Table.Name
+	for _, item := range order.Items {
+		r.Lines = append(r.Lines, receipt.Line{
+			Name:     item.ItemName,
+			Quantity: item.Quantity,
+			Price:    item.Price,
+			Discount: item.Discount,
+			Amount:   item.Subtotal,
+		})
+	}
+	r.Subtotal = order.Subtotal
+	r.Discount = order.DiscountTotal
+	r.ServiceCharge = order.ServiceCharge
+	r.ServiceRate = order.ServiceChargePercent
+	r.Taxes = order.Taxes
+	r.TaxInclusive = order.TaxInclusive
+	r.Total = order.Total
+}
+
+// invoiceBalance returns the balance recorded on an invoice, or nil when it
+// records none. A balance of a customer other than the one on the receipt,
+// such as a table's customer billed at payout, names them instead.
+func invoiceBalance(tx *gorm.DB, invoice models.Invoice, r *receipt.Receipt) *models.Money {
+	if invoice.CustomerID == nil {
+		return nil
+	}
+	var customer models.Customer
+	if err := tx.Select("name").First(&customer, *invoice.CustomerID).Error; err == nil {
+		r.Customer = customer.Name
+	}
+	return &invoice.Balance
+}
+
+// GetOrderReceipt renders the bill of an order. A billed order is printed as
+// a numbered invoice; an open order as an unnumbered pro forma bill to check
+// before paying.
+func GetOrderReceipt(c *gin.Context) {
+	var r receipt.Receipt
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := applyTenantScope(tx, c).Preload("Table").Preload("Customer").Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).First(&order, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Order not found")
+		}
+		if order.Status == models.OrderCancelled {
+			return abortTx(http.StatusConflict, "Order was cancelled")
+		}
+
+		r = receipt.Receipt{
+			CafeName: receiptCafeName(tx, order.TenantID),
+			Title:    "PRO FORMA BILL",
+			IssuedAt: time.Now(),
+			Customer: order.Customer.Name,
+			Staff:    staffName(tx, order.WaiterID),
+			Balance:  &order.Customer.CreditBalance,
+		}
+		addOrder(&r, order)
+
+		if order.BilledAt != nil {
+			invoice, err := findInvoice(tx, &order.ID, nil)
+			if err != nil {
+				return err
+			}
+			r.Title = "INVOICE"
+			r.Invoice = invoice.Code()
+			r.IssuedAt = *order.BilledAt
+			r.Balance = invoiceBalance(tx, invoice, &r)
+		}
+		if order.Status == models.OrderVoid {
+			r.Title = "INVOICE (VOID)"
+			r.Notes = append(r.Notes, "This order was voided and is not payable.")
+		}
+
+		var payments []models.Payment
+		if err := tx.Where("order_id = ?", order.ID).Order("created_at").Find(&payments).Error; err != nil {
+			return err
+		}
+		for _, p := range payments {
+			r.Payments = append(r.Payments, receipt.Payment{Method: p.Method, Amount: p.Amount})
+		}
+		if order.Notes != "" {
+			r.Notes = append(r.Notes, order.Notes)
+		}
+		return nil
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to build receipt")
+		return
+	}
+
+	writeReceipt(c, r, fmt.Sprintf("order-%s", c.Param("id")))
+}
+
+// GetPaymentReceipt renders a numbered receipt for a payment, with the
+// order it paid for when there is one.
+func GetPaymentReceipt(c *gin.Context) {
+	var r receipt.Receipt
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := applyTenantScope(tx, c).Preload("Customer").Preload("Order.Table").Preload("Order.Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).First(&payment, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Payment not found")
+		}
+
+		invoice, err := findInvoice(tx, nil, &payment.ID)
+		if err != nil {
+			return err
+		}
+
+		r = receipt.Receipt{
+			CafeName: receiptCafeName(tx, payment.TenantID),
+			Title:    "PAYMENT RECEIPT",
+			Invoice:  invoice.Code(),
+			IssuedAt: payment.CreatedAt,
+			Customer: payment.Customer.Name,
+			Staff:    staffName(tx, payment.CreatedByID),
+			Payments: []receipt.Payment{{Method: payment.Method, Amount: payment.Amount}},
+		}
+		r.Balance = invoiceBalance(tx, invoice, &r)
+		if payment.Order != nil {
+			addOrder(&r, *payment.Order)
+		}
+		if payment.RefundOfID != nil {
+			r.Title = "REFUND RECEIPT"
+			r.Notes = append(r.Notes, fmt.Sprintf("Refund of payment #%d: %s", *payment.RefundOfID, payment.Reason))
+		}
+		if payment.Notes != "" {
+			r.Notes = append(r.Notes, payment.Notes)
+		}
+		return nil
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to build receipt")
+		return
+	}
+
+	writeReceipt(c, r, fmt.Sprintf("payment-%s", c.Param("id")))
+}
+
+// writeReceipt sends the receipt in the format asked for with ?format=:
+// pdf (the default) or escpos, a raw stream for a thermal printer whose
+// line width can be given with ?columns=.
+func writeReceipt(c *gin.Context, r receipt.Receipt, name string) {
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		doc, err := receipt.PDF(r)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render receipt"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, name))
+		c.Data(http.StatusOK, "application/pdf", doc)
+	case "escpos":
+		columns := receipt.DefaultColumns
+		if v := c.Query("columns"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 24 || n > 64 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "columns must be between 24 and 64"})
+				return
+			}
+			columns = n
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.bin"`, name))
+		c.Data(http.StatusOK, "application/octet-stream", receipt.ESCPOS(r, columns))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or escpos"})
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInvoicesIssuedWhenBilled(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	mustCreate(t, db, &customer)
+	table, orders := seatTable(t, db, &customer, 30000, 20000)
+
+	// 350.00 of the 500.00 bill is paid, leaving 150.00 owed
+	w := testRequest(t, PayoutTable, tableParams(table), gin.H{"amount": models.Money(35000)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("payout status = %d, body %s", w.Code, w.Body)
+	}
+
+	var invoices []models.Invoice
+	if err := db.Order("number").Find(&invoices).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Both orders, then a payment against each
+	if len(invoices) != 4 {
+		t.Fatalf("got %d invoices, want 4", len(invoices))
+	}
+	for i, inv := range invoices {
+		if inv.Number != uint(i+1) {
+			t.Errorf("invoice %d number = %d", i, inv.Number)
+		}
+		if inv.Balance != 15000 {
+			t.Errorf("invoice %s balance = %s, want 150.00", inv.Code(), inv.Balance)
+		}
+	}
+	if invoices[0].OrderID == nil || *invoices[0].OrderID != orders[0].ID {
+		t.Errorf("first invoice is not for the first order")
+	}
+	if invoices[2].PaymentID == nil {
+		t.Errorf("third invoice is not for a payment")
+	}
+
+	// Settling the rest later leaves the bill's invoice as it was
+	w = testRequest(t, CreatePayment, nil, gin.H{"customer_id": customer.ID, "amount": models.Money(15000)})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("payment status = %d, body %s", w.Code, w.Body)
+	}
+	var latest models.Invoice
+	if err := db.Order("number DESC").First(&latest).Error; err != nil {
+		t.Fatal(err)
+	}
+	if latest.Number != 5 || latest.PaymentID == nil || latest.Balance != 0 {
+		t.Errorf("new payment invoice = %+v, want number 5 with balance 0", latest)
+	}
+
+	// Printing reads the stored invoice and writes nothing
+	params := gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(orders[0].ID), 10)}}
+	for i := 0; i < 2; i++ {
+		w = testRequest(t, GetOrderReceipt, params, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("receipt status = %d, body %s", w.Code, w.Body)
+		}
+	}
+	var count int64
+	db.Model(&models.Invoice{}).Count(&count)
+	if count != 5 {
+		t.Errorf("printing changed the invoice count to %d", count)
+	}
+	var first models.Invoice
+	if err := db.Where("order_id = ?", orders[0].ID).First(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	if first.Number != 1 || first.Balance != 15000 {
+		t.Errorf("order invoice = %+v, want number 1 with balance 150.00", first)
+	}
+}
+
+func TestInvoiceBalanceOfTheCustomerCharged(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	ram := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	sita := models.Customer{TenantID: &tenantID, Name: "Sita"}
+	mustCreate(t, db, &ram)
+	mustCreate(t, db, &sita)
+
+	orderInvoice := func(order models.Order) models.Invoice {
+		t.Helper()
+		var invoice models.Invoice
+		if err := db.Where("order_id = ?", order.ID).First(&invoice).Error; err != nil {
+			t.Fatal(err)
+		}
+		return invoice
+	}
+
+	// Sita's order on Ram's table is charged to Ram at payout
+	table, orders := seatTable(t, db, &ram, 30000)
+	db.Model(&orders[0]).Update("customer_id", sita.ID)
+	if w := testRequest(t, PayoutTable, tableParams(table), gin.H{"amount": models.Money(10000)}); w.Code != http.StatusOK {
+		t.Fatalf("payout status = %d, body %s", w.Code, w.Body)
+	}
+	invoice := orderInvoice(orders[0])
+	if invoice.CustomerID == nil || *invoice.CustomerID != ram.ID || invoice.Balance != 20000 {
+		t.Errorf("payout invoice = %+v, want Ram's balance of 200.00", invoice)
+	}
+
+	// An order split between Ram and Sita records no balance
+	table, orders = seatTable(t, db, &ram, 20000)
+	w := testRequest(t, SplitTable, tableParams(table), SplitRequest{
+		Mode:   SplitEqually,
+		Payers: []SplitPayer{{CustomerID: &ram.ID}, {CustomerID: &sita.ID}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("split status = %d, body %s", w.Code, w.Body)
+	}
+	if invoice := orderInvoice(orders[0]); invoice.CustomerID != nil || invoice.Balance != 0 {
+		t.Errorf("split invoice = %+v, want no balance", invoice)
+	}
+	params := gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(orders[0].ID), 10)}}
+	if w := testRequest(t, GetOrderReceipt, params, nil); w.Code != http.StatusOK {
+		t.Errorf("split receipt status = %d, body %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxReportDays bounds the period of a single report.
+const maxReportDays = 366
+
+// zReportLockKey namespaces the advisory lock on a cafe's business days.
+const zReportLockKey = int64(0x5a5250) << 32
+
+// dayLockKey is the advisory lock key of a cafe's business days. Changes to
+// a day's totals hold it shared from the check that the day is open until
+// they commit, and closing a day holds it exclusively, so a day cannot be
+// closed while such a change is in flight.
+func dayLockKey(tenantID *uint) int64 {
+	key := zReportLockKey
+	if tenantID != nil {
+		key |= int64(*tenantID)
+	}
+	return key
+}
+
+// businessLocation is the time zone business days are counted in: the
+// server's. Every date a request names is read in it.
+var businessLocation = time.Local
+
+// parseBusinessDay parses a YYYY-MM-DD date as the start of that business
+// day.
+func parseBusinessDay(date string) (time.Time, error) {
+	return time.ParseInLocation(models.BusinessDate, date, businessLocation)
+}
+
+// reportRange reads the from and to query parameters (YYYY-MM-DD, inclusive)
+// as business days in the server's time zone. Both default to today, and to
+// defaults to from.
+func reportRange(c *gin.Context) (start, end time.Time, err error) {
+	today := time.Now().In(businessLocation).Format(models.BusinessDate)
+	from := c.DefaultQuery("from", today)
+	to := c.DefaultQuery("to", from)
+
+	start, err = parseBusinessDay(from)
+	if err != nil {
+		return start, end, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+	}
+	last, err := parseBusinessDay(to)
+	if err != nil {
+		return start, end, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+	}
+	if last.Before(start) {
+		return start, end, fmt.Errorf("to must not be before from")
+	}
+	end = last.AddDate(0, 0, 1)
+	if end.After(start.AddDate(0, 0, maxReportDays)) {
+		return start, end, fmt.Errorf("reports cover at most %d days", maxReportDays)
+	}
+	return start, end, nil
+}
+
+// billedOrders returns the orders billed in [start, end) that still stand.
+func billedOrders(tx *gorm.DB, c *gin.Context, start, end time.Time) ([]models.Order, error) {
+	var orders []models.Order
+	err := strictTenantScope(tx, c).
+		Where("status = ? AND billed_at >= ? AND billed_at < ?", models.OrderBilled, start, end).
+		Order("billed_at").
+		Find(&orders).Error
+	return orders, err
+}
+
+// methodTotalColumns selects the columns of models.MethodTotal from payments
+// grouped by method. Refunds are negative payments.
+const methodTotalColumns = "method, COUNT(*) AS payments, COALESCE(SUM(amount), 0) AS amount, " +
+	"COALESCE(SUM(CASE WHEN amount < 0 THEN -amount ELSE 0 END), 0) AS refunds"
+
+// paymentTotals groups the payments taken in [start, end) by method.
+func paymentTotals(tx *gorm.DB, c *gin.Context, start, end time.Time) ([]models.MethodTotal, error) {
+	totals := []models.MethodTotal{}
+	err := strictTenantScope(tx.Model(&models.Payment{}), c).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Select(methodTotalColumns).
+		Group("method").
+		Order("amount DESC").
+		Scan(&totals).Error
+	return totals, err
+}
+
+// creditTotals sums the ledger entries posted in [start, end).
+func creditTotals(tx *gorm.DB, c *gin.Context, start, end time.Time) (models.CreditTotals, error) {
+	var totals models.CreditTotals
+	var byType []models.LedgerEntry
+	err := strictTenantScope(tx.Model(&models.LedgerEntry{}), c).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Select("type, COALESCE(SUM(amount), 0) AS amount").
+		Group("type").
+		Scan(&byType).Error
+	for _, entry := range byType {
+		totals.Add(entry)
+	}
+	return totals, err
+}
+
+// GetSalesReport returns billed sales per business day over a period, with
+// discounts, service charge and tax, and the period's totals.
+func GetSalesReport(c *gin.Context) {
+	start, end, err := reportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, err := billedOrders(database.DB, c, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build sales report"})
+		return
+	}
+
+	type salesDay struct {
+		Date string `json:"date"`
+		models.SalesTotals
+	}
+	var days []salesDay
+	index := map[string]int{}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		index[d.Format(models.BusinessDate)] = len(days)
+		days = append(days, salesDay{Date: d.Format(models.BusinessDate)})
+	}
+
+	var totals models.SalesTotals
+	for _, order := range orders {
+		day := order.BilledAt.In(businessLocation).Format(models.BusinessDate)
+		days[index[day]].Add(order)
+		totals.Add(order)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   start.Format(models.BusinessDate),
+		"to":     end.AddDate(0, 0, -1).Format(models.BusinessDate),
+		"days":   days,
+		"totals": totals,
+	})
+}
+
+// GetPaymentsReport returns the payments taken over a period grouped by
+// payment method.
+func GetPaymentsReport(c *gin.Context) {
+	start, end, err := reportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	methods, err := paymentTotals(database.DB, c, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build payments report"})
+		return
+	}
+	var total, refunds models.Money
+	for _, m := range methods {
+		total = total.Add(m.Amount)
+		refunds = refunds.Add(m.Refunds)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    start.Format(models.BusinessDate),
+		"to":      end.AddDate(0, 0, -1).Format(models.BusinessDate),
+		"methods": methods,
+		"total":   total,
+		"refunds": refunds,
+	})
+}
+
+// GetCreditReport compares the credit extended to customer accounts over a
+// period with what was collected against them, next to what customers owe
+// now.
+func GetCreditReport(c *gin.Context) {
+	start, end, err := reportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	totals, err := creditTotals(database.DB, c, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build credit report"})
+		return
+	}
+	var outstanding models.Money
+	if err := strictTenantScope(database.DB.Model(&models.Customer{}), c).
+		Select("COALESCE(SUM(credit_balance), 0)").
+		Scan(&outstanding).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build credit report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        start.Format(models.BusinessDate),
+		"to":          end.AddDate(0, 0, -1).Format(models.BusinessDate),
+		"credit":      totals,
+		"outstanding": outstanding,
+	})
+}
+
+// TopItem is a menu item's sales over a report period.
+type TopItem struct {
+	MenuItemID *uint        `json:"menu_item_id"`
+	ItemName   string       `json:"item_name"`
+	Quantity   int          `json:"quantity"`
+	Revenue    models.Money `json:"revenue"`
+}
+
+// GetTopItemsReport returns the best-selling items of billed orders over a
+// period by quantity. Revenue is after line discounts. limit defaults to 10.
+func GetTopItemsReport(c *gin.Context) {
+	start, end, err := reportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := 10
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+	}
+
+	billed := strictTenantScope(database.DB.Model(&models.Order{}), c).
+		Where("status = ? AND billed_at >= ? AND billed_at < ?", models.OrderBilled, start, end).
+		Select("id")
+
+	items := []TopItem{}
+	if err := strictTenantScope(database.DB.Model(&models.OrderItem{}), c).
+		Where("order_id IN (?)", billed).
+		Select("menu_item_id, item_name, SUM(quantity) AS quantity, SUM(subtotal - discount) AS revenue").
+		Group("menu_item_id, item_name").
+		Order("quantity DESC, revenue DESC").
+		Limit(limit).
+		Scan(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build top items report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  start.Format(models.BusinessDate),
+		"to":    end.AddDate(0, 0, -1).Format(models.BusinessDate),
+		"items": items,
+	})
+}
+
+// GetHourlyReport returns a heatmap of billed orders over a period by day of
+// the week (0 is Sunday) and hour of the day, in the server's time zone.
+func GetHourlyReport(c *gin.Context) {
+	start, end, err := reportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, err := billedOrders(database.DB, c, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build hourly report"})
+		return
+	}
+
+	var counts [7][24]int
+	var sales [7][24]models.Money
+	for _, order := range orders {
+		at := order.BilledAt.In(businessLocation)
+		day, hour := int(at.Weekday()), at.Hour()
+		counts[day][hour]++
+		sales[day][hour] = sales[day][hour].Add(order.Total)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   start.Format(models.BusinessDate),
+		"to":     end.AddDate(0, 0, -1).Format(models.BusinessDate),
+		"orders": counts,
+		"sales":  sales,
+	})
+}
+
+// ensureDayOpen refuses a change that would alter the totals of a business
+// day already closed with a Z-report, and keeps the day from being closed
+// until the change commits.
+func ensureDayOpen(tx *gorm.DB, tenantID *uint, at time.Time) error {
+	if err := advisoryLockShared(tx, dayLockKey(tenantID)); err != nil {
+		return err
+	}
+	return checkDayOpen(tx, tenantID, at)
+}
+
+// checkDayOpen refuses a business day already closed with a Z-report.
+func checkDayOpen(tx *gorm.DB, tenantID *uint, at time.Time) error {
+	day := at.In(businessLocation).Format(models.BusinessDate)
+	var closed int64
+	if err := cafeScope(tx.Model(&models.ZReport{}), tenantID).
+		Where("business_date = ?", day).
+		Count(&closed).Error; err != nil {
+		return err
+	}
+	if closed > 0 {
+		return abortTx(http.StatusConflict, "Business day "+day+" is closed")
+	}
+	return nil
+}
+
+// CloseBusinessDay takes the Z-report of a business day, today unless a
+// date is given, and locks the day's totals. A day is closed only once.
+func CloseBusinessDay(c *gin.Context) {
+	var req struct {
+		Date string `json:"date"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Date == "" {
+		req.Date = time.Now().In(businessLocation).Format(models.BusinessDate)
+	}
+	start, err := parseBusinessDay(req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be a date in YYYY-MM-DD format"})
+		return
+	}
+	if start.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot close a business day that has not started"})
+		return
+	}
+	end := start.AddDate(0, 0, 1)
+	tenantID := getTenantID(c)
+
+	report := models.ZReport{
+		TenantID:     tenantID,
+		BusinessDate: req.Date,
+		ClosedByID:   getActorID(c),
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Wait for changes that found the day open to commit, and keep new
+		// ones out until the report is taken
+		if err := advisoryLock(tx, dayLockKey(tenantID)); err != nil {
+			return err
+		}
+		if err := checkDayOpen(tx, tenantID, start); err != nil {
+			return err
+		}
+
+		orders, err := billedOrders(tx, c, start, end)
+		if err != nil {
+			return err
+		}
+		for _, order := range orders {
+			report.Add(order)
+		}
+
+		var voided []models.Order
+		if err := strictTenantScope(tx, c).
+			Where("status = ? AND voided_at >= ? AND voided_at < ?", models.OrderVoid, start, end).
+			Find(&voided).Error; err != nil {
+			return err
+		}
+		for _, order := range voided {
+			report.Voids++
+			report.VoidedAmount = report.VoidedAmount.Add(order.Total)
+		}
+
+		if report.Payments, err = paymentTotals(tx, c, start, end); err != nil {
+			return err
+		}
+		for _, m := range report.Payments {
+			report.PaymentsTotal = report.PaymentsTotal.Add(m.Amount)
+		}
+		if report.Credit, err = creditTotals(tx, c, start, end); err != nil {
+			return err
+		}
+
+		var open int64
+		if err := strictTenantScope(tx.Model(&models.Order{}), c).
+			Where("status NOT IN ?", models.ClosedOrderStatuses).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		report.OpenOrders = int(open)
+
+		if err := tx.Create(&report).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "z_report", report.ID, nil, report)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to close business day")
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// GetZReports lists the Z-reports of a period, newest first.
+func GetZReports(c *gin.Context) {
+	start, end, err := reportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reports := []models.ZReport{}
+	if err := cafeScope(database.DB, getTenantID(c)).
+		Where("business_date >= ? AND business_date < ?", start.Format(models.BusinessDate), end.Format(models.BusinessDate)).
+		Order("business_date DESC").
+		Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Z-reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
+
+// GetZReport returns the Z-report of one business day.
+func GetZReport(c *gin.Context) {
+	var report models.ZReport
+	err := cafeScope(database.DB, getTenantID(c)).
+		Where("business_date = ?", c.Param("date")).
+		First(&report).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business day is not closed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Z-report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/events"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultReservationHold is the hold used when RESERVATION_HOLD is not set.
+const defaultReservationHold = 30 * time.Minute
+
+// reservationHold is how long before a booking its tables are marked
+// reserved. It is read once from RESERVATION_HOLD, a Go duration like "30m";
+// "0" turns holding off, and a value that is not a duration is logged and
+// replaced by the default.
+var reservationHold = sync.OnceValue(func() time.Duration {
+	return parseReservationHold(os.Getenv("RESERVATION_HOLD"))
+})
+
+func parseReservationHold(value string) time.Duration {
+	if value == "" {
+		return defaultReservationHold
+	}
+	hold, err := time.ParseDuration(value)
+	if err != nil || hold < 0 {
+		log.Printf("RESERVATION_HOLD=%q is not a duration of zero or more, using %s", value, defaultReservationHold)
+		return defaultReservationHold
+	}
+	return hold
+}
+
+type ReservationRequest struct {
+	CustomerID *uint     `json:"customer_id"`
+	GuestName  string    `json:"guest_name"`
+	GuestPhone string    `json:"guest_phone"`
+	PartySize  int       `json:"party_size" binding:"required,min=1"`
+	StartsAt   time.Time `json:"starts_at" binding:"required"`
+	EndsAt     time.Time `json:"ends_at" binding:"required"`
+	TableIDs   []uint    `json:"table_ids" binding:"required,min=1"`
+	Notes      string    `json:"notes"`
+}
+
+// overlappingReservations selects the active reservations on any of the
+// tables whose window overlaps [start, end).
+func overlappingReservations(db *gorm.DB, tableIDs []uint, start, end time.Time) *gorm.DB {
+	return db.Model(&models.Reservation{}).
+		Joins("JOIN reservation_tables ON reservation_tables.reservation_id = reservations.id").
+		Where("reservation_tables.table_id IN ?", tableIDs).
+		Where("reservations.status IN ?", models.ActiveReservationStatuses).
+		Where("reservations.starts_at < ? AND reservations.ends_at > ?", end, start)
+}
+
+// prepareReservation validates a booking request against the tables it
+// names, which it locks so concurrent bookings of the same table serialize.
+// excludeID skips the reservation being edited in the overlap check.
+func prepareReservation(tx *gorm.DB, c *gin.Context, req ReservationRequest, excludeID uint) ([]models.Table, error) {
+	if !req.EndsAt.After(req.StartsAt) {
+		return nil, abortTx(http.StatusBadRequest, "ends_at must be after starts_at")
+	}
+	if req.CustomerID == nil && req.GuestName == "" {
+		return nil, abortTx(http.StatusBadRequest, "customer_id or guest_name is required")
+	}
+	if req.CustomerID != nil {
+		var customer models.Customer
+		if err := strictTenantScope(tx, c).First(&customer, *req.CustomerID).Error; err != nil {
+			return nil, abortTx(http.StatusNotFound, "Customer not found")
+		}
+	}
+
+	unique := map[uint]bool{}
+	for _, id := range req.TableIDs {
+		unique[id] = true
+	}
+	var tables []models.Table
+	if err := applyTenantScope(forUpdate(tx), c).Where("id IN ?", req.TableIDs).Order("id").Find(&tables).Error; err != nil {
+		return nil, err
+	}
+	if len(tables) != len(unique) {
+		return nil, abortTx(http.StatusNotFound, "Table not found")
+	}
+
+	seats := 0
+	for _, table := range tables {
+		seats += table.Seats
+	}
+	if seats < req.PartySize {
+		return nil, abortTx(http.StatusBadRequest, fmt.Sprintf("The tables seat %d, the party is %d", seats, req.PartySize))
+	}
+
+	var clash models.Reservation
+	err := overlappingReservations(tx, req.TableIDs, req.StartsAt, req.EndsAt).
+		Where("reservations.id <> ?", excludeID).
+		First(&clash).Error
+	if err == nil {
+		return nil, abortTx(http.StatusConflict, fmt.Sprintf("The tables are already booked by reservation #%d from %s to %s",
+			clash.ID, clash.StartsAt.Format(time.RFC3339), clash.EndsAt.Format(time.RFC3339)))
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return tables, nil
+}
+
+func GetReservations(c *gin.Context) {
+	query := applyTenantScope(database.DB, c).Preload("Tables").Preload("Customer")
+
+	// Filter by day
+	if date := c.Query("date"); date != "" {
+		day, err := parseBusinessDay(date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+			return
+		}
+		query = query.Where("starts_at < ? AND ends_at > ?", day.AddDate(0, 0, 1), day)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if tableID := c.Query("table_id"); tableID != "" {
+		query = query.Where("id IN (?)", database.DB.Table("reservation_tables").
+			Select("reservation_id").
+			Where("table_id = ?", tableID))
+	}
+
+	var reservations []models.Reservation
+	if err := query.Order("starts_at").Find(&reservations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reservations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reservations)
+}
+
+func GetReservation(c *gin.Context) {
+	var reservation models.Reservation
+	if err := applyTenantScope(database.DB, c).Preload("Tables").Preload("Customer").First(&reservation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// GetTableAvailability lists the tables free for a whole time window that
+// seat at least party_size, smallest first.
+func GetTableAvailability(c *gin.Context) {
+	start, err := time.Parse(time.RFC3339, c.Query("starts_at"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at must be an RFC 3339 time"})
+		return
+	}
+	end, err := time.Parse(time.RFC3339, c.Query("ends_at"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be an RFC 3339 time"})
+		return
+	}
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+	partySize := 1
+	if size := c.Query("party_size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "party_size must be a positive number"})
+			return
+		}
+		partySize = n
+	}
+
+	booked := database.DB.Table("reservation_tables").
+		Select("reservation_tables.table_id").
+		Joins("JOIN reservations ON reservations.id = reservation_tables.reservation_id").
+		Where("reservations.deleted_at IS NULL").
+		Where("reservations.status IN ?", models.ActiveReservationStatuses).
+		Where("reservations.starts_at < ? AND reservations.ends_at > ?", end, start)
+
+	var tables []models.Table
+	if err := applyTenantScope(database.DB, c).
+		Where("id NOT IN (?)", booked).
+		Where("seats >= ?", partySize).
+		Order("seats, name").
+		Find(&tables).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"starts_at":  start,
+		"ends_at":    end,
+		"party_size": partySize,
+		"tables":     tables,
+	})
+}
+
+func CreateReservation(c *gin.Context) {
+	var req ReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.StartsAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at must not be in the past"})
+		return
+	}
+
+	reservation := models.Reservation{
+		TenantID:    getTenantID(c),
+		CustomerID:  req.CustomerID,
+		GuestName:   req.GuestName,
+		GuestPhone:  req.GuestPhone,
+		PartySize:   req.PartySize,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Status:      models.ReservationBooked,
+		Notes:       req.Notes,
+		CreatedByID: getActorID(c),
+		UpdatedByID: getActorID(c),
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		tables, err := prepareReservation(tx, c, req, 0)
+		if err != nil {
+			return err
+		}
+		reservation.Tables = tables
+		if err := tx.Create(&reservation).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "reservation", reservation.ID, nil, reservation)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to create reservation")
+		return
+	}
+
+	database.DB.Preload("Tables").Preload("Customer").First(&reservation, reservation.ID)
+
+	c.JSON(http.StatusCreated, reservation)
+}
+
+// UpdateReservation reschedules a booked reservation or changes its guest,
+// party or tables. Tables it no longer uses are released.
+func UpdateReservation(c *gin.Context) {
+	var req ReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reservation models.Reservation
+	var raised pendingEvents
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyTenantScope(forUpdate(tx), c).Preload("Tables").First(&reservation, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Reservation not found")
+		}
+		if !reservation.Booked() {
+			return abortTx(http.StatusConflict, "Only booked reservations can be changed")
+		}
+		// A late party can still be edited, but not moved into the past
+		if !req.StartsAt.Equal(reservation.StartsAt) && req.StartsAt.Before(time.Now()) {
+			return abortTx(http.StatusBadRequest, "starts_at must not be in the past")
+		}
+
+		tables, err := prepareReservation(tx, c, req, reservation.ID)
+		if err != nil {
+			return err
+		}
+
+		before := reservation
+		if err := tx.Model(&reservation).Updates(map[string]interface{}{
+			"customer_id":   req.CustomerID,
+			"guest_name":    req.GuestName,
+			"guest_phone":   req.GuestPhone,
+			"party_size":    req.PartySize,
+			"starts_at":     req.StartsAt,
+			"ends_at":       req.EndsAt,
+			"notes":         req.Notes,
+			"updated_by_id": getActorID(c),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&reservation).Association("Tables").Replace(tables); err != nil {
+			return err
+		}
+		reservation.Tables = tables
+		if err := recordAudit(tx, c, models.AuditUpdate, "reservation", reservation.ID, before, reservation); err != nil {
+			return err
+		}
+		return releaseTables(tx, c, before.Tables, &raised)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update reservation")
+		return
+	}
+	raised.publish(c)
+
+	database.DB.Preload("Tables").Preload("Customer").First(&reservation, reservation.ID)
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// SeatReservation seats the party: its tables become occupied by the
+// reservation's customer or guest.
+func SeatReservation(c *gin.Context) {
+	var reservation models.Reservation
+	var raised pendingEvents
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyTenantScope(forUpdate(tx), c).First(&reservation, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Reservation not found")
+		}
+		if !reservation.Booked() {
+			return abortTx(http.StatusConflict, "Reservation is "+string(reservation.Status))
+		}
+
+		var tables []models.Table
+		if err := forUpdate(tx).
+			Where("id IN (?)", tx.Table("reservation_tables").Select("table_id").Where("reservation_id = ?", reservation.ID)).
+			Order("id").
+			Find(&tables).Error; err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if table.Status == models.TableOccupied {
+				return abortTx(http.StatusConflict, table.Name+" is occupied")
+			}
+		}
+
+		for _, table := range tables {
+			before := table
+			if err := tx.Model(&table).Updates(map[string]interface{}{
+				"status":         models.TableOccupied,
+				"customer_id":    reservation.CustomerID,
+				"guest_name":     reservation.GuestName,
+				"guest_phone":    reservation.GuestPhone,
+				"updated_by_id":  getActorID(c),
+				"assigned_by_id": getActorID(c),
+			}).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, models.AuditUpdate, "table", table.ID, before, table); err != nil {
+				return err
+			}
+			raised.add(events.TableStatusChanged, table)
+		}
+
+		before := reservation
+		now := time.Now()
+		if err := tx.Model(&reservation).Updates(map[string]interface{}{
+			"status":        models.ReservationSeated,
+			"seated_at":     now,
+			"updated_by_id": getActorID(c),
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "reservation", reservation.ID, before, reservation)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to seat reservation")
+		return
+	}
+	raised.publish(c)
+
+	database.DB.Preload("Tables").Preload("Customer").First(&reservation, reservation.ID)
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// CancelReservation cancels a booked reservation and releases its tables.
+func CancelReservation(c *gin.Context) {
+	closeReservation(c, models.ReservationCancelled)
+}
+
+// MarkReservationNoShow records that the guests never came and releases the
+// tables.
+func MarkReservationNoShow(c *gin.Context) {
+	closeReservation(c, models.ReservationNoShow)
+}
+
+func closeReservation(c *gin.Context, status models.ReservationStatus) {
+	var reservation models.Reservation
+	var raised pendingEvents
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyTenantScope(forUpdate(tx), c).Preload("Tables").First(&reservation, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Reservation not found")
+		}
+		if !reservation.Booked() {
+			return abortTx(http.StatusConflict, "Reservation is "+string(reservation.Status))
+		}
+
+		before := reservation
+		if err := tx.Model(&reservation).Updates(map[string]interface{}{
+			"status":        status,
+			"updated_by_id": getActorID(c),
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditUpdate, "reservation", reservation.ID, before, reservation); err != nil {
+			return err
+		}
+		return releaseTables(tx, c, reservation.Tables, &raised)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update reservation")
+		return
+	}
+	raised.publish(c)
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// releaseTables frees tables that were held as reserved, unless another
+// booking still holds them.
+func releaseTables(tx *gorm.DB, c *gin.Context, tables []models.Table, raised *pendingEvents) error {
+	now := time.Now()
+	for _, t := range tables {
+		var table models.Table
+		if err := forUpdate(tx).First(&table, t.ID).Error; err != nil {
+			continue
+		}
+		if table.Status != models.TableReserved {
+			continue
+		}
+
+		var held int64
+		if err := overlappingReservations(tx, []uint{table.ID}, now, now.Add(reservationHold())).
+			Where("reservations.status = ?", models.ReservationBooked).
+			Count(&held).Error; err != nil {
+			return err
+		}
+		if held > 0 {
+			continue
+		}
+
+		before := table
+		if err := tx.Model(&table).Updates(map[string]interface{}{
+			"status":        models.TableFree,
+			"updated_by_id": getActorID(c),
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditUpdate, "table", table.ID, before, table); err != nil {
+			return err
+		}
+		raised.add(events.TableStatusChanged, table)
+	}
+	return nil
+}
+
+// HoldReservedTables marks free tables as reserved when one of their
+// bookings starts within the hold window.
+func HoldReservedTables(now time.Time) error {
+	var reservations []models.Reservation
+	if err := database.DB.Preload("Tables").
+		Where("status = ? AND starts_at <= ? AND ends_at > ?", models.ReservationBooked, now.Add(reservationHold()), now).
+		Find(&reservations).Error; err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		for _, t := range reservation.Tables {
+			if t.Status != models.TableFree {
+				continue
+			}
+
+			var table models.Table
+			held := false
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				if err := forUpdate(tx).First(&table, t.ID).Error; err != nil {
+					return err
+				}
+				if table.Status != models.TableFree {
+					return nil
+				}
+
+				before := table
+				if err := tx.Model(&table).Update("status", models.TableReserved).Error; err != nil {
+					return err
+				}
+				held = true
+				return writeAudit(tx, models.AuditEvent{
+					TenantID: table.TenantID,
+					Entity:   "table",
+					EntityID: table.ID,
+					Action:   models.AuditUpdate,
+				}, before, table)
+			})
+			if err != nil {
+				return err
+			}
+			if held {
+				events.Default.Publish(table.TenantID, events.TableStatusChanged, table)
+			}
+		}
+	}
+	return nil
+}
+
+// RunReservationSweeper holds tables for upcoming reservations every
+// interval. It runs until the process exits.
+func RunReservationSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := HoldReservedTables(now); err != nil {
+			log.Printf("reservation sweeper: %v", err)
+		}
+	}
+}
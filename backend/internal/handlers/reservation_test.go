@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseReservationHold(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultReservationHold},
+		{"45m", 45 * time.Minute},
+		{"0", 0},
+		{"-5m", defaultReservationHold},
+		{"soon", defaultReservationHold},
+	}
+	for _, tt := range tests {
+		if got := parseReservationHold(tt.value); got != tt.want {
+			t.Errorf("parseReservationHold(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReservationStartsInTheFuture(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	table := models.Table{TenantID: &tenantID, Name: "T1", Seats: 4, Status: models.TableFree}
+	mustCreate(t, db, &table)
+
+	request := func(startsAt time.Time) ReservationRequest {
+		return ReservationRequest{
+			GuestName: "Sita",
+			PartySize: 2,
+			StartsAt:  startsAt,
+			EndsAt:    startsAt.Add(2 * time.Hour),
+			TableIDs:  []uint{table.ID},
+		}
+	}
+
+	if w := testRequest(t, CreateReservation, nil, request(time.Now().Add(-time.Hour))); w.Code != http.StatusBadRequest {
+		t.Errorf("booking in the past: status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+	if w := testRequest(t, CreateReservation, nil, request(time.Now().Add(time.Hour))); w.Code != http.StatusCreated {
+		t.Fatalf("booking ahead: status %d: %s", w.Code, w.Body)
+	}
+
+	// A party running late keeps its start time while the booking is edited
+	startsAt := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	late := models.Reservation{TenantID: &tenantID, GuestName: "Sita", PartySize: 2,
+		StartsAt: startsAt, EndsAt: startsAt.Add(time.Hour), Status: models.ReservationBooked}
+	mustCreate(t, db, &late)
+	params := gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(late.ID), 10)}}
+
+	req := request(startsAt)
+	req.EndsAt = startsAt.Add(time.Hour)
+	req.Notes = "Running late"
+	if w := testRequest(t, UpdateReservation, params, req); w.Code != http.StatusOK {
+		t.Errorf("editing a late booking: status %d: %s", w.Code, w.Body)
+	}
+	req.StartsAt = startsAt.Add(-time.Hour)
+	if w := testRequest(t, UpdateReservation, params, req); w.Code != http.StatusBadRequest {
+		t.Errorf("moving a booking into the past: status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// tokenTTL reads a duration such as "15m" from the environment.
+func tokenTTL(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// sessionOptions customises issueSession. The zero value starts a regular
+// login session.
+type sessionOptions struct {
+	// terminalID binds the session to a shared terminal
+	terminalID *uint
+	// expiresAt caps the session; zero means REFRESH_TOKEN_TTL from now
+	expiresAt time.Time
+}
+
+// issueSession starts a new session for the user and returns the access and
+// refresh tokens for it.
+func issueSession(tx *gorm.DB, c *gin.Context, user models.User, opts sessionOptions) (AuthResponse, error) {
+	refreshToken, hash, err := newOpaqueToken()
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	expiresAt := opts.expiresAt
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(tokenTTL("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL))
+	}
+
+	session := models.Session{
+		TenantID:   user.TenantID,
+		UserID:     user.ID,
+		TokenHash:  hash,
+		ExpiresAt:  expiresAt,
+		TerminalID: opts.terminalID,
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return AuthResponse{}, err
+	}
+
+	accessTTL := tokenTTL("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+	token, err := generateToken(user, session.ID, accessTTL)
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	return AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTTL.Seconds()),
+		SessionID:    session.ID,
+		User:         newUserResponse(user),
+	}, nil
+}
+
+// revokeSessions revokes every active session of a user.
+func revokeSessions(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeAudited revokes sessions on behalf of the current user and records
+// each revocation in the audit log.
+func revokeAudited(tx *gorm.DB, c *gin.Context, sessions []models.Session) error {
+	now := time.Now()
+	for _, session := range sessions {
+		before := session
+		if err := tx.Model(&session).Update("revoked_at", &now).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditUpdate, "session", session.ID, before, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshToken rotates a refresh token: the presented session is revoked and
+// a new one issued. Presenting an already rotated token means it was stolen
+// or replayed, so every session of that user is revoked.
+func RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resp AuthResponse
+	reused := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		if err := forUpdate(tx).Where("token_hash = ?", hashToken(req.RefreshToken)).First(&session).Error; err != nil {
+			return abortTx(http.StatusUnauthorized, "Invalid refresh token")
+		}
+
+		if session.ReplacedByID != nil {
+			reused = true
+			if err := revokeSessions(tx, session.UserID); err != nil {
+				return err
+			}
+			return nil
+		}
+		if !session.Active(time.Now()) {
+			return abortTx(http.StatusUnauthorized, "Refresh token expired or revoked")
+		}
+
+		var user models.User
+		if err := tx.First(&user, session.UserID).Error; err != nil || !user.Active {
+			return abortTx(http.StatusUnauthorized, "User not found")
+		}
+
+		// Terminal sessions keep their device binding and original expiry
+		opts := sessionOptions{}
+		if session.TerminalID != nil {
+			opts = sessionOptions{terminalID: session.TerminalID, expiresAt: session.ExpiresAt}
+		}
+
+		var err error
+		resp, err = issueSession(tx, c, user, opts)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"replaced_by_id": resp.SessionID,
+		}).Error
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to refresh token")
+		return
+	}
+	if reused {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected; all sessions revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Logout revokes the session of the presented access token.
+func Logout(c *gin.Context) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var sessions []models.Session
+		if err := forUpdate(tx).Where("id = ? AND revoked_at IS NULL", c.GetUint("session_id")).
+			Find(&sessions).Error; err != nil {
+			return err
+		}
+		return revokeAudited(tx, c, sessions)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// RevokeUserSessions signs a user out everywhere, e.g. when they leave.
+func RevokeUserSessions(c *gin.Context) {
+	user, err := findManagedUser(database.DB, c, c.Param("id"))
+	if err != nil {
+		respondTxError(c, err, "Failed to revoke sessions")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var sessions []models.Session
+		if err := forUpdate(tx).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Find(&sessions).Error; err != nil {
+			return err
+		}
+		return revokeAudited(tx, c, sessions)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked"})
+}
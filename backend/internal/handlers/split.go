@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Ways of dividing a table's bill between payers
+const (
+	SplitByItem   = "item"
+	SplitEqually  = "equal"
+	SplitByAmount = "amount"
+)
+
+// SplitPayer is one person paying part of a split bill. A payer is billed to
+// CustomerID, or else to a guest account made from GuestName and GuestPhone.
+// ItemIDs are used when splitting by item and Amount when splitting by
+// amount. Paid defaults to the payer's whole share; whatever is not paid
+// stays on the payer's account.
+type SplitPayer struct {
+	CustomerID *uint         `json:"customer_id"`
+	GuestName  string        `json:"guest_name"`
+	GuestPhone string        `json:"guest_phone"`
+	ItemIDs    []uint        `json:"item_ids"`
+	Amount     models.Money  `json:"amount"`
+	Paid       *models.Money `json:"paid"`
+	Method     string        `json:"method"`
+}
+
+type SplitRequest struct {
+	Mode   string       `json:"mode" binding:"required"`
+	Payers []SplitPayer `json:"payers" binding:"required,min=1"`
+	Notes  string       `json:"notes"`
+}
+
+// SplitShare is what one payer was billed and paid.
+type SplitShare struct {
+	CustomerID uint         `json:"customer_id"`
+	Name       string       `json:"name"`
+	Share      models.Money `json:"share"`
+	Paid       models.Money `json:"paid"`
+	OnAccount  models.Money `json:"on_account"`
+	PaymentIDs []uint       `json:"payment_ids,omitempty"`
+}
+
+// SplitTable settles a table, or its whole bill group, between several
+// payers. What is left to pay on the open orders after any payments already
+// taken against them is divided up. The orders are billed and each payer's
+// share is charged to their own account per order, so voiding an order later
+// reverses the right charges. Each payer who pays gets payments of their own,
+// one against each order their share covers.
+func SplitTable(c *gin.Context) {
+	id := c.Param("id")
+
+	var req SplitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mode != SplitByItem && req.Mode != SplitEqually && req.Mode != SplitByAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be item, equal or amount"})
+		return
+	}
+
+	var total, due models.Money
+	var shares []SplitShare
+	var settled []uint
+	var raised pendingEvents
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var table models.Table
+		if err := applyTenantScope(forUpdate(tx), c).First(&table, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Table not found")
+		}
+
+		group, err := lockBillGroup(tx, table)
+		if err != nil {
+			return err
+		}
+		tableIDs := make([]uint, 0, len(group))
+		for _, t := range group {
+			tableIDs = append(tableIDs, t.ID)
+		}
+		settled = tableIDs
+
+		var orders []models.Order
+		if err := applyTenantScope(forUpdate(tx), c).Where("table_id IN ? AND status NOT IN ?", tableIDs, models.ClosedOrderStatuses).Order("id").Find(&orders).Error; err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return abortTx(http.StatusConflict, "Table has no open orders")
+		}
+		total, due = 0, 0
+		for _, order := range orders {
+			total = total.Add(order.Total)
+			due = due.Add(order.Due())
+		}
+
+		// Work out what each payer owes on each order
+		owed, err := splitShares(tx, req, orders)
+		if err != nil {
+			return err
+		}
+
+		// Find or create every payer's account before anything is posted
+		customers := make([]models.Customer, len(req.Payers))
+		seen := map[uint]bool{}
+		for i, p := range req.Payers {
+			if p.CustomerID != nil {
+				if err := strictTenantScope(forUpdate(tx), c).First(&customers[i], *p.CustomerID).Error; err != nil {
+					return abortTx(http.StatusNotFound, fmt.Sprintf("Customer %d not found", *p.CustomerID))
+				}
+			} else {
+				customers[i], err = guestCustomer(tx, c, p.GuestName, p.GuestPhone, fmt.Sprintf("Guest %d - %s", i+1, table.Name))
+				if err != nil {
+					return err
+				}
+			}
+			if seen[customers[i].ID] {
+				return abortTx(http.StatusBadRequest, "Each payer must be a different customer")
+			}
+			seen[customers[i].ID] = true
+		}
+
+		shares = make([]SplitShare, len(req.Payers))
+		for i, p := range req.Payers {
+			share := models.Money(0)
+			for _, amount := range owed[i] {
+				share = share.Add(amount)
+			}
+			paid := share
+			if p.Paid != nil {
+				paid = *p.Paid
+			}
+			if paid < 0 || paid > share {
+				return abortTx(http.StatusBadRequest, fmt.Sprintf("Payer %d must pay between 0 and their share", i+1))
+			}
+			shares[i] = SplitShare{
+				CustomerID: customers[i].ID,
+				Name:       customers[i].Name,
+				Share:      share,
+				Paid:       paid,
+				OnAccount:  share.Sub(paid),
+			}
+		}
+
+		// Bill the orders and charge each payer their part of every order
+		now := time.Now()
+		for i := range orders {
+			if err := billOrder(tx, c, &orders[i], now, &raised); err != nil {
+				return err
+			}
+			orderID := orders[i].ID
+			for p := range req.Payers {
+				if err := postLedger(tx, c, &customers[p], models.LedgerEntry{
+					Type:    models.LedgerCharge,
+					Amount:  owed[p][orderID],
+					OrderID: &orderID,
+					Notes:   "Split at " + table.Name,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		var paymentIDs []uint
+		for i, p := range req.Payers {
+			if shares[i].Paid == 0 {
+				continue
+			}
+			payment := models.Payment{
+				Amount: shares[i].Paid,
+				Method: p.Method,
+				Notes:  req.Notes,
+			}
+			due := make([]models.Money, len(orders))
+			for k, order := range orders {
+				due[k] = owed[i][order.ID]
+			}
+			ids, err := recordTablePayment(tx, c, &customers[i], payment, orders, due, table, &raised)
+			if err != nil {
+				return err
+			}
+			shares[i].PaymentIDs = ids
+			paymentIDs = append(paymentIDs, ids...)
+		}
+
+		if err := invoiceBill(tx, orders, paymentIDs); err != nil {
+			return err
+		}
+		return closeBill(tx, c, table, group, now, &raised)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to split bill")
+		return
+	}
+	raised.publish(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Bill split successfully",
+		"mode":      req.Mode,
+		"total":     total,
+		"due":       due,
+		"payers":    shares,
+		"table_ids": settled,
+	})
+}
+
+// splitShares returns, for each payer in req, the amount owed per order ID.
+// The shares always add up to what is due on the orders.
+func splitShares(tx *gorm.DB, req SplitRequest, orders []models.Order) ([]map[uint]models.Money, error) {
+	owed := make([]map[uint]models.Money, len(req.Payers))
+	for i := range owed {
+		owed[i] = map[uint]models.Money{}
+	}
+
+	if req.Mode == SplitByItem {
+		orderIDs := make([]uint, 0, len(orders))
+		for _, order := range orders {
+			orderIDs = append(orderIDs, order.ID)
+		}
+		var items []models.OrderItem
+		if err := tx.Where("order_id IN ?", orderIDs).Order("id").Find(&items).Error; err != nil {
+			return nil, err
+		}
+
+		// Each line carries its part of the order total, so the order's
+		// discount, service charge and tax are shared like the items
+		byOrder := map[uint][]int{}
+		for i, item := range items {
+			byOrder[item.OrderID] = append(byOrder[item.OrderID], i)
+		}
+		lineTotals := make([]models.Money, len(items))
+		for _, order := range orders {
+			lines := byOrder[order.ID]
+			weights := make([]models.Money, len(lines))
+			for k, i := range lines {
+				weights[k] = items[i].Subtotal.Sub(items[i].Discount)
+			}
+			for k, part := range models.Allocate(order.Due(), weights) {
+				lineTotals[lines[k]] = part
+			}
+		}
+		byID := map[uint]int{}
+		for i, item := range items {
+			byID[item.ID] = i
+		}
+
+		assigned := map[uint]bool{}
+		for p, payer := range req.Payers {
+			for _, itemID := range payer.ItemIDs {
+				i, ok := byID[itemID]
+				if !ok {
+					return nil, abortTx(http.StatusBadRequest, fmt.Sprintf("Item %d is not on this bill", itemID))
+				}
+				if assigned[itemID] {
+					return nil, abortTx(http.StatusBadRequest, fmt.Sprintf("Item %d is assigned to more than one payer", itemID))
+				}
+				assigned[itemID] = true
+				orderID := items[i].OrderID
+				owed[p][orderID] = owed[p][orderID].Add(lineTotals[i])
+			}
+		}
+		if len(assigned) != len(items) {
+			return nil, abortTx(http.StatusBadRequest, "Every item must be assigned to a payer")
+		}
+		return owed, nil
+	}
+
+	var total models.Money
+	for _, order := range orders {
+		total = total.Add(order.Due())
+	}
+
+	amounts := make([]models.Money, len(req.Payers))
+	if req.Mode == SplitEqually {
+		// The paisa that do not divide evenly go to the first payers
+		n := models.Money(len(req.Payers))
+		for i := range amounts {
+			amounts[i] = total / n
+			if models.Money(i) < total%n {
+				amounts[i]++
+			}
+		}
+	} else {
+		var sum models.Money
+		for i, p := range req.Payers {
+			if p.Amount < 0 {
+				return nil, abortTx(http.StatusBadRequest, "Amounts cannot be negative")
+			}
+			amounts[i] = p.Amount
+			sum = sum.Add(p.Amount)
+		}
+		if sum != total {
+			return nil, abortTx(http.StatusBadRequest, "Amounts must add up to what is due on the bill")
+		}
+	}
+
+	// Fill the orders in turn, so each payer's share is charged against the
+	// orders it covers
+	o, left := 0, orders[0].Due()
+	for i, amount := range amounts {
+		for amount > 0 {
+			for left == 0 {
+				o++
+				left = orders[o].Due()
+			}
+			part := amount
+			if part > left {
+				part = left
+			}
+			owed[i][orders[o].ID] = owed[i][orders[o].ID].Add(part)
+			amount = amount.Sub(part)
+			left = left.Sub(part)
+		}
+	}
+	return owed, nil
+}
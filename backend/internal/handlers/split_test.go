@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+)
+
+func TestSplitShares(t *testing.T) {
+	tests := []struct {
+		name   string
+		totals []models.Money
+		// paid is what was already paid against each order
+		paid []models.Money
+		// items are the line subtotals of each order; payers' ItemIDs index
+		// into them in order, with -1 standing for an item on another bill
+		items  [][]models.Money
+		mode   string
+		payers []SplitPayer
+		pick   [][]int
+		// want is what each payer owes on each order
+		want       [][]models.Money
+		wantStatus int
+	}{
+		{
+			name:   "equally with the odd paisa to the first payers",
+			totals: []models.Money{30000, 5000},
+			mode:   SplitEqually,
+			payers: make([]SplitPayer, 3),
+			want:   [][]models.Money{{11667, 0}, {11667, 0}, {6666, 5000}},
+		},
+		{
+			name:   "equally past a settled order",
+			totals: []models.Money{0, 1001},
+			mode:   SplitEqually,
+			payers: make([]SplitPayer, 2),
+			want:   [][]models.Money{{0, 501}, {0, 500}},
+		},
+		{
+			name:   "by amount",
+			totals: []models.Money{30000, 5000},
+			mode:   SplitByAmount,
+			payers: []SplitPayer{{Amount: 10000}, {Amount: 25000}},
+			want:   [][]models.Money{{10000, 0}, {20000, 5000}},
+		},
+		{
+			name:   "by amount with a payer owing nothing",
+			totals: []models.Money{30000, 5000},
+			mode:   SplitByAmount,
+			payers: []SplitPayer{{Amount: 0}, {Amount: 35000}},
+			want:   [][]models.Money{{0, 0}, {30000, 5000}},
+		},
+		{
+			name:   "equally what is left after a payment",
+			totals: []models.Money{30000, 5000},
+			paid:   []models.Money{10000, 0},
+			mode:   SplitEqually,
+			payers: make([]SplitPayer, 2),
+			want:   [][]models.Money{{12500, 0}, {7500, 5000}},
+		},
+		{
+			name:   "equally past an order paid in full",
+			totals: []models.Money{30000, 5000},
+			paid:   []models.Money{30000, 0},
+			mode:   SplitEqually,
+			payers: make([]SplitPayer, 2),
+			want:   [][]models.Money{{0, 2500}, {0, 2500}},
+		},
+		{
+			name:       "amounts adding up to the total but not what is due",
+			totals:     []models.Money{30000, 5000},
+			paid:       []models.Money{5000, 0},
+			mode:       SplitByAmount,
+			payers:     []SplitPayer{{Amount: 10000}, {Amount: 25000}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "amounts short of the total",
+			totals:     []models.Money{30000, 5000},
+			mode:       SplitByAmount,
+			payers:     []SplitPayer{{Amount: 10000}, {Amount: 10000}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "negative amount",
+			totals:     []models.Money{30000, 5000},
+			mode:       SplitByAmount,
+			payers:     []SplitPayer{{Amount: -1}, {Amount: 35001}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// The first order's tax is shared 6780/4520 over its lines
+			name:   "by item",
+			totals: []models.Money{11300, 5000},
+			items:  [][]models.Money{{6000, 4000}, {5000}},
+			mode:   SplitByItem,
+			payers: make([]SplitPayer, 2),
+			pick:   [][]int{{0, 2}, {1}},
+			want:   [][]models.Money{{6780, 5000}, {4520, 0}},
+		},
+		{
+			// What is left of the first order is shared 6102/4068
+			name:   "by item what is left after a payment",
+			totals: []models.Money{11300, 5000},
+			paid:   []models.Money{1130, 0},
+			items:  [][]models.Money{{6000, 4000}, {5000}},
+			mode:   SplitByItem,
+			payers: make([]SplitPayer, 2),
+			pick:   [][]int{{0, 2}, {1}},
+			want:   [][]models.Money{{6102, 5000}, {4068, 0}},
+		},
+		{
+			name:       "item left unassigned",
+			totals:     []models.Money{11300, 5000},
+			items:      [][]models.Money{{6000, 4000}, {5000}},
+			mode:       SplitByItem,
+			payers:     make([]SplitPayer, 2),
+			pick:       [][]int{{0}, {1}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "item assigned twice",
+			totals:     []models.Money{11300, 5000},
+			items:      [][]models.Money{{6000, 4000}, {5000}},
+			mode:       SplitByItem,
+			payers:     make([]SplitPayer, 2),
+			pick:       [][]int{{0, 2}, {1, 2}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "item from another bill",
+			totals:     []models.Money{11300, 5000},
+			items:      [][]models.Money{{6000, 4000}, {5000}},
+			mode:       SplitByItem,
+			payers:     make([]SplitPayer, 2),
+			pick:       [][]int{{0, 2}, {1, -1}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID := testTenantID
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+			_, orders := seatTable(t, db, &customer, tt.totals...)
+			for o, paid := range tt.paid {
+				orders[o].AmountPaid = paid
+			}
+
+			var itemIDs []uint
+			for o, subtotals := range tt.items {
+				for _, subtotal := range subtotals {
+					item := models.OrderItem{TenantID: &tenantID, OrderID: orders[o].ID, ItemName: "Momo", Quantity: 1, Price: subtotal}
+					mustCreate(t, db, &item)
+					itemIDs = append(itemIDs, item.ID)
+				}
+			}
+			req := SplitRequest{Mode: tt.mode, Payers: append([]SplitPayer(nil), tt.payers...)}
+			for p, picks := range tt.pick {
+				for _, i := range picks {
+					id := uint(9999)
+					if i >= 0 {
+						id = itemIDs[i]
+					}
+					req.Payers[p].ItemIDs = append(req.Payers[p].ItemIDs, id)
+				}
+			}
+
+			owed, err := splitShares(db, req, orders)
+			if tt.wantStatus != 0 {
+				var te *txError
+				if !errors.As(err, &te) || te.status != tt.wantStatus {
+					t.Fatalf("err = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := make([]map[uint]models.Money, len(tt.want))
+			for p, parts := range tt.want {
+				want[p] = map[uint]models.Money{}
+				for o, part := range parts {
+					if part != 0 {
+						want[p][orders[o].ID] = part
+					}
+				}
+			}
+			if !reflect.DeepEqual(owed, want) {
+				t.Errorf("owed = %v, want %v", owed, want)
+			}
+
+			var sum, due models.Money
+			for _, shares := range owed {
+				for _, part := range shares {
+					sum = sum.Add(part)
+				}
+			}
+			for _, order := range orders {
+				due = due.Add(order.Due())
+			}
+			if sum != due {
+				t.Errorf("shares add up to %s, want %s", sum, due)
+			}
+		})
+	}
+}
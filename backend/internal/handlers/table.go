@@ -1,12 +1,17 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/events"
 	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetTables(c *gin.Context) {
@@ -41,7 +46,15 @@ func CreateTable(c *gin.Context) {
 	}
 	// Assign tenant
 	table.TenantID = getTenantID(c)
-	if err := database.DB.Create(&table).Error; err != nil {
+	table.CreatedByID = getActorID(c)
+	table.UpdatedByID = getActorID(c)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&table).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "table", table.ID, nil, table)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create table"})
 		return
 	}
@@ -49,6 +62,23 @@ func CreateTable(c *gin.Context) {
 	c.JSON(http.StatusCreated, table)
 }
 
+// checkTableAssignment validates the status and customer a request puts on
+// a table, responding with an error if they are not acceptable. The customer
+// must be one of the cafe's, since a table's customer is charged at payout.
+func checkTableAssignment(c *gin.Context, status models.TableStatus, customerID *uint) bool {
+	if !status.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be free, occupied or reserved"})
+		return false
+	}
+	if customerID != nil {
+		if err := strictTenantScope(database.DB, c).First(&models.Customer{}, *customerID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return false
+		}
+	}
+	return true
+}
+
 func UpdateTable(c *gin.Context) {
 	id := c.Param("id")
 
@@ -64,6 +94,9 @@ func UpdateTable(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTableAssignment(c, updateData.Status, updateData.CustomerID) {
+		return
+	}
 
 	// Update fields
 	updates := map[string]interface{}{
@@ -72,26 +105,51 @@ func UpdateTable(c *gin.Context) {
 		"position_y":  updateData.PositionY,
 		"width":       updateData.Width,
 		"height":      updateData.Height,
-		"status":      updateData.Status,
-		"customer_id": updateData.CustomerID,
+		"status":        updateData.Status,
+		"customer_id":   updateData.CustomerID,
+		"updated_by_id": getActorID(c),
+	}
+	if updateData.Seats > 0 {
+		updates["seats"] = updateData.Seats
 	}
 
-	if err := database.DB.Model(&table).Updates(updates).Error; err != nil {
+	before := table
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&table).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "table", table.ID, before, table)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update table"})
 		return
 	}
 
 	// Fetch updated table with customer
 	applyTenantScope(database.DB, c).Preload("Customer").First(&table, id)
+	if table.Status != before.Status {
+		publish(c, events.TableStatusChanged, table)
+	}
 
 	c.JSON(http.StatusOK, table)
 }
 
 func DeleteTable(c *gin.Context) {
 	id := c.Param("id")
-	// Tenant scoping applied via applyTenantScope
-	if err := applyTenantScope(database.DB, c).Delete(&models.Table{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete table"})
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Tenant scoping applied via applyTenantScope
+		var table models.Table
+		if err := applyTenantScope(forUpdate(tx), c).First(&table, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Table not found")
+		}
+		if err := tx.Delete(&table).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditDelete, "table", table.ID, table, nil)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to delete table")
 		return
 	}
 
@@ -113,6 +171,10 @@ func AssignCustomerToTable(c *gin.Context) {
 		return
 	}
 
+	if !checkTableAssignment(c, req.Status, req.CustomerID) {
+		return
+	}
+
 	// Tenant scoping applied via applyTenantScope
 	var table models.Table
 	if err := applyTenantScope(database.DB, c).First(&table, id).Error; err != nil {
@@ -121,43 +183,75 @@ func AssignCustomerToTable(c *gin.Context) {
 	}
 
 	updates := map[string]interface{}{
-		"customer_id": req.CustomerID,
-		"status":      req.Status,
-		"guest_name":  req.GuestName,
-		"guest_phone": req.GuestPhone,
+		"customer_id":    req.CustomerID,
+		"status":         req.Status,
+		"guest_name":     req.GuestName,
+		"guest_phone":    req.GuestPhone,
+		"updated_by_id":  getActorID(c),
+		"assigned_by_id": getActorID(c),
+	}
+	if req.Status == models.TableFree {
+		updates["assigned_by_id"] = nil
+		updates["bill_group_id"] = nil
 	}
 
-	if err := database.DB.Model(&table).Updates(updates).Error; err != nil {
+	before := table
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&table).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "table", table.ID, before, table)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign customer"})
 		return
 	}
 
 	applyTenantScope(database.DB, c).Preload("Customer").First(&table, id)
+	publish(c, events.TableStatusChanged, table)
 
 	c.JSON(http.StatusOK, table)
 }
 
+// GetTableOrders returns the open orders on a table. For a merged table it
+// returns the orders of every table in its bill group.
 func GetTableOrders(c *gin.Context) {
 	id := c.Param("id")
 
-	var orders []models.Order
+	var table models.Table
 	// Tenant scoping applied via applyTenantScope
+	if err := applyTenantScope(database.DB, c).First(&table, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+		return
+	}
+
+	tableIDs := []uint{table.ID}
+	if table.BillGroupID != nil {
+		if err := database.DB.Model(&models.Table{}).Where("bill_group_id = ?", *table.BillGroupID).Pluck("id", &tableIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+	}
+
+	var orders []models.Order
 	if err := applyTenantScope(database.DB, c).Preload("Items").Preload("Customer").
-		Where("table_id = ? AND status != ?", id, models.OrderBilled).
+		Where("table_id IN ? AND status NOT IN ?", tableIDs, models.ClosedOrderStatuses).
 		Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
 
 	// Calculate total
-	var total float64
+	var total models.Money
 	for _, order := range orders {
-		total += order.Total
+		total = total.Add(order.Total)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"orders": orders,
-		"total":  total,
+		"orders":        orders,
+		"total":         total,
+		"bill_group_id": table.BillGroupID,
+		"table_ids":     tableIDs,
 	})
 }
 
@@ -165,99 +259,526 @@ func PayoutTable(c *gin.Context) {
 	id := c.Param("id")
 
 	var req struct {
-		Amount float64 `json:"amount" binding:"required"`
-		Method string  `json:"method"`
-		Notes  string  `json:"notes"`
+		Amount models.Money `json:"amount"`
+		Method string       `json:"method"`
+		Notes  string       `json:"notes"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Tenant scoping applied via applyTenantScope
-	var table models.Table
-	if err := applyTenantScope(database.DB, c).Preload("Customer").First(&table, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+	// Nothing paid puts the whole bill on the customer's account
+	if req.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount cannot be negative"})
 		return
 	}
 
-	// Get all unbilled orders for this table
-	var orders []models.Order
-	applyTenantScope(database.DB, c).Where("table_id = ? AND status != ?", id, models.OrderBilled).Find(&orders)
+	var totalAmount, totalDue, remainingCredit models.Money
+	var settled []uint
+	var raised pendingEvents
+
+	// Settle the table atomically; the table and customer rows stay locked
+	// until the payment and balance changes are committed.
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Tenant scoping applied via applyTenantScope
+		var table models.Table
+		if err := applyTenantScope(forUpdate(tx), c).First(&table, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Table not found")
+		}
 
-	// Calculate total
-	var totalAmount float64
-	for _, order := range orders {
-		totalAmount += order.Total
-	}
+		// A merged table is settled together with the rest of its bill group
+		group, err := lockBillGroup(tx, table)
+		if err != nil {
+			return err
+		}
+		tableIDs := make([]uint, 0, len(group))
+		for _, t := range group {
+			tableIDs = append(tableIDs, t.ID)
+		}
+		settled = tableIDs
+
+		// Get all open orders for these tables
+		var orders []models.Order
+		if err := applyTenantScope(forUpdate(tx), c).Where("table_id IN ? AND status NOT IN ?", tableIDs, models.ClosedOrderStatuses).Order("id").Find(&orders).Error; err != nil {
+			return err
+		}
+
+		// Calculate total, and what is left to pay after any payments
+		// already taken against the orders
+		totalAmount, totalDue = 0, 0
+		for _, order := range orders {
+			totalAmount = totalAmount.Add(order.Total)
+			totalDue = totalDue.Add(order.Due())
+		}
+
+		if req.Amount > totalDue {
+			return abortTx(http.StatusBadRequest, "Payment amount exceeds what is due")
+		}
+
+		// Bill the table's customer, or failing that, the first customer
+		// seated in the group
+		payer := table
+		for _, t := range group {
+			if payer.CustomerID == nil && t.CustomerID != nil {
+				payer = t
+			}
+		}
+
+		// Create or get customer
+		var customer models.Customer
+		if payer.CustomerID != nil {
+			if err := cafeScope(forUpdate(tx), table.TenantID).First(&customer, *payer.CustomerID).Error; err != nil {
+				return abortTx(http.StatusNotFound, "Customer not found")
+			}
+		} else {
+			// Create a customer from guest info or use a default guest customer
+			customer, err = guestCustomer(tx, c, payer.GuestName, payer.GuestPhone, "Guest - "+table.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Mark all orders as billed and charge what is left to pay on them to
+		// the customer's account
+		now := time.Now()
+		var paymentIDs []uint
+		for i := range orders {
+			if err := billOrder(tx, c, &orders[i], now, &raised); err != nil {
+				return err
+			}
+			orderID := orders[i].ID
+			if err := postLedger(tx, c, &customer, models.LedgerEntry{
+				Type:    models.LedgerCharge,
+				Amount:  orders[i].Due(),
+				OrderID: &orderID,
+				Notes:   "Billed at " + table.Name,
+			}); err != nil {
+				return err
+			}
+		}
+
+		// Record payment if amount provided; whatever is left stays on credit
+		// and is paid against the orders oldest first
+		if req.Amount > 0 {
+			payment := models.Payment{
+				Amount: req.Amount,
+				Method: req.Method,
+				Notes:  req.Notes,
+			}
+			due := make([]models.Money, len(orders))
+			for i, order := range orders {
+				due[i] = order.Due()
+			}
+			if paymentIDs, err = recordTablePayment(tx, c, &customer, payment, orders, due, table, &raised); err != nil {
+				return err
+			}
+		}
+
+		remainingCredit = totalDue.Sub(req.Amount)
 
-	if req.Amount > totalAmount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment amount exceeds order total"})
+		if err := invoiceBill(tx, orders, paymentIDs); err != nil {
+			return err
+		}
+		return closeBill(tx, c, table, group, now, &raised)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to complete payout")
 		return
 	}
+	raised.publish(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Payout completed successfully",
+		"total":            totalAmount,
+		"due":              totalDue,
+		"paid":             req.Amount,
+		"remaining_credit": remainingCredit,
+		"table_ids":        settled,
+	})
+}
 
-	// Create or get customer
-	var customerID uint
-	if table.CustomerID != nil {
-		customerID = *table.CustomerID
-	} else {
-		// Create a customer from guest info or use a default guest customer
-		customer := models.Customer{
-			Name:          table.GuestName,
-			Phone:         table.GuestPhone,
-			CreditBalance: 0,
+// guestCustomer returns the account a walk-in guest is billed to: the
+// customer already on file under the guest's phone, or a new one. fallback
+// names the account when the guest gave no name.
+func guestCustomer(tx *gorm.DB, c *gin.Context, name, phone, fallback string) (models.Customer, error) {
+	var customer models.Customer
+	if phone != "" {
+		err := strictTenantScope(forUpdate(tx), c).Where("phone = ?", phone).First(&customer).Error
+		if err == nil {
+			return customer, nil
 		}
-		if customer.Name == "" {
-			customer.Name = "Guest - " + table.Name
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return customer, err
 		}
-		customer.TenantID = getTenantID(c)
-		database.DB.Create(&customer)
-		customerID = customer.ID
 	}
 
-	// Mark all orders as billed
-	for _, order := range orders {
-		order.Status = models.OrderBilled
-		database.DB.Save(&order)
+	customer = models.Customer{
+		Name:          name,
+		Phone:         phone,
+		CreditBalance: 0,
+	}
+	if customer.Name == "" {
+		customer.Name = fallback
+	}
+	customer.TenantID = getTenantID(c)
+	if err := tx.Create(&customer).Error; err != nil {
+		return customer, err
+	}
+	return customer, recordAudit(tx, c, models.AuditCreate, "customer", customer.ID, nil, customer)
+}
+
+// billOrder moves a locked order to billed. Charging it to an account is up
+// to the caller.
+func billOrder(tx *gorm.DB, c *gin.Context, order *models.Order, now time.Time, raised *pendingEvents) error {
+	if err := ensureDayOpen(tx, order.TenantID, now); err != nil {
+		return err
+	}
+	before := *order
+	updates, err := order.Transition(models.OrderBilled, now)
+	if err != nil {
+		return err
+	}
+	updates["updated_by_id"] = getActorID(c)
+	if err := tx.Model(order).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := recordAudit(tx, c, models.AuditUpdate, "order", order.ID, before, order); err != nil {
+		return err
+	}
+	raised.add(events.OrderStatusChanged, *order)
+	return nil
+}
+
+// recordTablePayment saves a payment made at table by customer and credits
+// it to the customer's account. The payment is divided between the locked
+// orders by what is due on each, and each part is recorded as a payment of
+// its own against its order. It returns the IDs of the payments made.
+func recordTablePayment(tx *gorm.DB, c *gin.Context, customer *models.Customer, payment models.Payment, orders []models.Order, due []models.Money, table models.Table, raised *pendingEvents) ([]uint, error) {
+	payment.CustomerID = customer.ID
+	if payment.Method == "" {
+		payment.Method = "cash"
+	}
+	payment.TenantID = getTenantID(c)
+	payment.CreatedByID = getActorID(c)
+	payment.UpdatedByID = getActorID(c)
+	sessionID, err := userCashSession(tx, payment.CreatedByID)
+	if err != nil {
+		return nil, err
 	}
+	payment.CashSessionID = sessionID
 
-	// Record payment if amount provided
-	if req.Amount > 0 {
-		payment := models.Payment{
-			CustomerID: customerID,
-			Amount:     req.Amount,
-			Method:     req.Method,
-			Notes:      req.Notes,
+	var ids []uint
+	for i, amount := range models.AllocatePayment(payment.Amount, due) {
+		if amount == 0 {
+			continue
 		}
-		if req.Method == "" {
-			payment.Method = "cash"
+		orderID := orders[i].ID
+		part := payment
+		part.Amount = amount
+		part.OrderID = &orderID
+		if err := tx.Create(&part).Error; err != nil {
+			return nil, err
 		}
-		payment.TenantID = getTenantID(c)
-		database.DB.Create(&payment)
+		if err := recordAudit(tx, c, models.AuditCreate, "payment", part.ID, nil, part); err != nil {
+			return nil, err
+		}
+		raised.add(events.PaymentRecorded, part)
+		if err := postLedger(tx, c, customer, models.LedgerEntry{
+			Type:      models.LedgerPayment,
+			Amount:    part.Amount.Neg(),
+			OrderID:   &orderID,
+			PaymentID: &part.ID,
+			Notes:     "Paid at " + table.Name,
+		}); err != nil {
+			return nil, err
+		}
+		if err := syncOrderPaid(tx, &orders[i]); err != nil {
+			return nil, err
+		}
+		ids = append(ids, part.ID)
 	}
+	return ids, nil
+}
 
-	// Update customer credit balance
-	remainingCredit := totalAmount - req.Amount
-	if remainingCredit > 0 {
-		var customer models.Customer
-		database.DB.First(&customer, customerID)
-		customer.CreditBalance += remainingCredit
-		database.DB.Save(&customer)
+// closeBill frees every table of a settled bill and closes its bill group.
+func closeBill(tx *gorm.DB, c *gin.Context, table models.Table, group []models.Table, now time.Time, raised *pendingEvents) error {
+	for i := range group {
+		if err := freeTable(tx, c, &group[i], raised); err != nil {
+			return err
+		}
+	}
+	if table.BillGroupID != nil {
+		return tx.Model(&models.BillGroup{}).Where("id = ?", *table.BillGroupID).Update("closed_at", now).Error
+	}
+	return nil
+}
+
+// lockBillGroup locks and returns every table billed together with table:
+// the whole bill group for a merged table, otherwise just the table.
+func lockBillGroup(tx *gorm.DB, table models.Table) ([]models.Table, error) {
+	if table.BillGroupID == nil {
+		return []models.Table{table}, nil
+	}
+	var group []models.Table
+	if err := forUpdate(tx).Where("bill_group_id = ?", *table.BillGroupID).Order("id").Find(&group).Error; err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// freeTable clears a table's guest and bill group and marks it free.
+func freeTable(tx *gorm.DB, c *gin.Context, table *models.Table, raised *pendingEvents) error {
+	before := *table
+	if err := tx.Model(table).Updates(map[string]interface{}{
+		"status":         models.TableFree,
+		"customer_id":    nil,
+		"guest_name":     "",
+		"guest_phone":    "",
+		"bill_group_id":  nil,
+		"updated_by_id":  getActorID(c),
+		"assigned_by_id": nil,
+	}).Error; err != nil {
+		return err
+	}
+	raised.add(events.TableStatusChanged, *table)
+	return recordAudit(tx, c, models.AuditUpdate, "table", table.ID, before, table)
+}
+
+// TransferTable moves a party to a free table: its open orders, customer or
+// guest, and bill group membership. The old table is freed.
+func TransferTable(c *gin.Context) {
+	var req struct {
+		ToTableID uint `json:"to_table_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Free the table
-	database.DB.Model(&table).Updates(map[string]interface{}{
-		"status":      models.TableFree,
-		"customer_id": nil,
-		"guest_name":  "",
-		"guest_phone": "",
+	fromID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+		return
+	}
+	if uint(fromID) == req.ToTableID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot transfer a table to itself"})
+		return
+	}
+
+	var from, to models.Table
+	var moved int64
+	var raised pendingEvents
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock both tables in ID order
+		var tables []models.Table
+		if err := applyTenantScope(forUpdate(tx), c).Where("id IN ?", []uint{uint(fromID), req.ToTableID}).Order("id").Find(&tables).Error; err != nil {
+			return err
+		}
+		for _, t := range tables {
+			if t.ID == uint(fromID) {
+				from = t
+			} else {
+				to = t
+			}
+		}
+		if from.ID == 0 || to.ID == 0 {
+			return abortTx(http.StatusNotFound, "Table not found")
+		}
+		if to.Status != models.TableFree {
+			return abortTx(http.StatusConflict, to.Name+" is not free")
+		}
+
+		result := tx.Model(&models.Order{}).
+			Where("table_id = ? AND status NOT IN ?", from.ID, models.ClosedOrderStatuses).
+			Updates(map[string]interface{}{
+				"table_id":      to.ID,
+				"updated_by_id": getActorID(c),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+		if moved == 0 && from.Status == models.TableFree {
+			return abortTx(http.StatusConflict, from.Name+" has no party to transfer")
+		}
+
+		status := from.Status
+		if status == models.TableFree {
+			status = models.TableOccupied
+		}
+		before := to
+		if err := tx.Model(&to).Updates(map[string]interface{}{
+			"status":         status,
+			"customer_id":    from.CustomerID,
+			"guest_name":     from.GuestName,
+			"guest_phone":    from.GuestPhone,
+			"bill_group_id":  from.BillGroupID,
+			"updated_by_id":  getActorID(c),
+			"assigned_by_id": from.AssignedByID,
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditUpdate, "table", to.ID, before, to); err != nil {
+			return err
+		}
+		raised.add(events.TableStatusChanged, to)
+
+		return freeTable(tx, c, &from, &raised)
 	})
+	if err != nil {
+		respondTxError(c, err, "Failed to transfer table")
+		return
+	}
+	raised.publish(c)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":         "Payout completed successfully",
-		"total":           totalAmount,
-		"paid":            req.Amount,
-		"remaining_credit": remainingCredit,
+		"message":      "Table transferred successfully",
+		"from":         from,
+		"to":           to,
+		"orders_moved": moved,
+	})
+}
+
+// MergeTables puts several tables into one bill group so a payout at any of
+// them settles them all. Tables already in a group bring the group along;
+// tables from two different groups cannot be merged.
+func MergeTables(c *gin.Context) {
+	var req struct {
+		TableIDs []uint `json:"table_ids" binding:"required,min=2"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var group models.BillGroup
+	var raised pendingEvents
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var tables []models.Table
+		if err := applyTenantScope(forUpdate(tx), c).Where("id IN ?", req.TableIDs).Order("id").Find(&tables).Error; err != nil {
+			return err
+		}
+		unique := map[uint]bool{}
+		for _, id := range req.TableIDs {
+			unique[id] = true
+		}
+		if len(tables) != len(unique) {
+			return abortTx(http.StatusNotFound, "Table not found")
+		}
+		if len(tables) < 2 {
+			return abortTx(http.StatusBadRequest, "Merge needs at least two tables")
+		}
+
+		var groupID *uint
+		for _, t := range tables {
+			if t.Status == models.TableFree {
+				return abortTx(http.StatusConflict, t.Name+" is free")
+			}
+			if t.BillGroupID != nil {
+				if groupID != nil && *groupID != *t.BillGroupID {
+					return abortTx(http.StatusConflict, "Tables belong to different bill groups")
+				}
+				groupID = t.BillGroupID
+			}
+		}
+
+		if groupID != nil {
+			if err := tx.First(&group, *groupID).Error; err != nil {
+				return err
+			}
+		} else {
+			group = models.BillGroup{
+				TenantID:    getTenantID(c),
+				CreatedByID: getActorID(c),
+			}
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, models.AuditCreate, "bill_group", group.ID, nil, group); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range tables {
+			if t.BillGroupID != nil {
+				continue
+			}
+			before := t
+			if err := tx.Model(&t).Updates(map[string]interface{}{
+				"bill_group_id": group.ID,
+				"updated_by_id": getActorID(c),
+			}).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, models.AuditUpdate, "table", t.ID, before, t); err != nil {
+				return err
+			}
+			raised.add(events.TableStatusChanged, t)
+		}
+		return nil
 	})
+	if err != nil {
+		respondTxError(c, err, "Failed to merge tables")
+		return
+	}
+	raised.publish(c)
+
+	database.DB.Preload("Tables").First(&group, group.ID)
+
+	c.JSON(http.StatusOK, group)
+}
+
+// UnmergeTable takes a table back out of its bill group. A group left with a
+// single table is closed.
+func UnmergeTable(c *gin.Context) {
+	var table models.Table
+	var raised pendingEvents
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyTenantScope(forUpdate(tx), c).First(&table, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Table not found")
+		}
+		if table.BillGroupID == nil {
+			return abortTx(http.StatusConflict, table.Name+" is not merged")
+		}
+		groupID := *table.BillGroupID
+
+		group, err := lockBillGroup(tx, table)
+		if err != nil {
+			return err
+		}
+		// The last two tables split apart together
+		leaving := []models.Table{table}
+		if len(group) <= 2 {
+			leaving = group
+		}
+
+		for _, t := range leaving {
+			before := t
+			if err := tx.Model(&t).Updates(map[string]interface{}{
+				"bill_group_id": nil,
+				"updated_by_id": getActorID(c),
+			}).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, models.AuditUpdate, "table", t.ID, before, t); err != nil {
+				return err
+			}
+			raised.add(events.TableStatusChanged, t)
+			if t.ID == table.ID {
+				table = t
+			}
+		}
+		if len(group) <= 2 {
+			return tx.Model(&models.BillGroup{}).Where("id = ?", groupID).Update("closed_at", time.Now()).Error
+		}
+		return nil
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to unmerge table")
+		return
+	}
+	raised.publish(c)
+
+	c.JSON(http.StatusOK, table)
 }
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// seatTable creates an occupied table for customer with an open order for
+// each of totals.
+func seatTable(t *testing.T, db *gorm.DB, customer *models.Customer, totals ...models.Money) (models.Table, []models.Order) {
+	t.Helper()
+	tenantID := testTenantID
+	table := models.Table{TenantID: &tenantID, Name: "T1", Status: models.TableOccupied, CustomerID: &customer.ID}
+	mustCreate(t, db, &table)
+	orders := make([]models.Order, len(totals))
+	for i, total := range totals {
+		orders[i] = models.Order{
+			TenantID:   &tenantID,
+			TableID:    table.ID,
+			CustomerID: customer.ID,
+			Status:     models.OrderServed,
+			Subtotal:   total,
+			Total:      total,
+		}
+		mustCreate(t, db, &orders[i])
+	}
+	return table, orders
+}
+
+func tableParams(table models.Table) gin.Params {
+	return gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(table.ID), 10)}}
+}
+
+func TestPayoutTableSettlesOrders(t *testing.T) {
+	tests := []struct {
+		name     string
+		totals   []models.Money
+		amount   models.Money
+		wantPaid []models.Money
+		wantOwed models.Money
+	}{
+		{"single order in full", []models.Money{50000}, 50000, []models.Money{50000}, 0},
+		{"two orders in full", []models.Money{30000, 20050}, 50050, []models.Money{30000, 20050}, 0},
+		{"partial covers first order", []models.Money{30000, 20000}, 35000, []models.Money{30000, 5000}, 15000},
+		{"partial within first order", []models.Money{30000, 20000}, 10000, []models.Money{10000, 0}, 40000},
+		{"nothing paid", []models.Money{30000, 20000}, 0, []models.Money{0, 0}, 50000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID := testTenantID
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+			table, orders := seatTable(t, db, &customer, tt.totals...)
+
+			w := testRequest(t, PayoutTable, tableParams(table), gin.H{"amount": tt.amount, "method": "cash"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			for i, want := range tt.wantPaid {
+				var order models.Order
+				if err := db.First(&order, orders[i].ID).Error; err != nil {
+					t.Fatal(err)
+				}
+				if order.Status != models.OrderBilled {
+					t.Errorf("order %d status = %s, want billed", i, order.Status)
+				}
+				if order.AmountPaid != want {
+					t.Errorf("order %d amount_paid = %s, want %s", i, order.AmountPaid, want)
+				}
+				if fullyPaid := want >= order.Total; (order.PaidAt != nil) != fullyPaid {
+					t.Errorf("order %d paid_at = %v, want set %v", i, order.PaidAt, fullyPaid)
+				}
+
+				var payments []models.Payment
+				if err := db.Where("order_id = ?", order.ID).Find(&payments).Error; err != nil {
+					t.Fatal(err)
+				}
+				if want == 0 && len(payments) != 0 || want != 0 && len(payments) != 1 {
+					t.Errorf("order %d has %d payments", i, len(payments))
+				}
+			}
+
+			var unlinked int64
+			db.Model(&models.Payment{}).Where("order_id IS NULL").Count(&unlinked)
+			if unlinked != 0 {
+				t.Errorf("%d payments not linked to an order", unlinked)
+			}
+			if err := db.First(&customer, customer.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if customer.CreditBalance != tt.wantOwed {
+				t.Errorf("credit balance = %s, want %s", customer.CreditBalance, tt.wantOwed)
+			}
+		})
+	}
+}
+
+func TestSplitTableSettlesOrders(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	ram := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	sita := models.Customer{TenantID: &tenantID, Name: "Sita"}
+	mustCreate(t, db, &ram)
+	mustCreate(t, db, &sita)
+	table, orders := seatTable(t, db, &ram, 30000, 20000)
+
+	// Equal shares fill the orders in turn: Ram owes 250.00 of the first
+	// order, Sita the other 50.00 of it and all 200.00 of the second. Sita
+	// pays 100.00 and leaves the rest on account
+	sitaPaid := models.Money(10000)
+	w := testRequest(t, SplitTable, tableParams(table), SplitRequest{
+		Mode: SplitEqually,
+		Payers: []SplitPayer{
+			{CustomerID: &ram.ID},
+			{CustomerID: &sita.ID, Paid: &sitaPaid},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	wantPaid := []models.Money{30000, 5000}
+	for i, want := range wantPaid {
+		var order models.Order
+		if err := db.First(&order, orders[i].ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if order.AmountPaid != want {
+			t.Errorf("order %d amount_paid = %s, want %s", i, order.AmountPaid, want)
+		}
+		if fullyPaid := want >= order.Total; (order.PaidAt != nil) != fullyPaid {
+			t.Errorf("order %d paid_at = %v, want set %v", i, order.PaidAt, fullyPaid)
+		}
+	}
+
+	var payments []models.Payment
+	if err := db.Order("id").Find(&payments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 3 {
+		t.Fatalf("got %d payments, want 3", len(payments))
+	}
+	for _, p := range payments {
+		if p.OrderID == nil {
+			t.Errorf("payment %d not linked to an order", p.ID)
+		}
+	}
+}
+
+// prepay takes a cash payment of amount from customer against order.
+func prepay(t *testing.T, customer models.Customer, order models.Order, amount models.Money) {
+	t.Helper()
+	w := testRequest(t, CreatePayment, nil, gin.H{"customer_id": customer.ID, "order_id": order.ID, "amount": amount, "method": "cash"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("payment status = %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestPayoutTableRejectsNegativeAmount(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	mustCreate(t, db, &customer)
+	table, orders := seatTable(t, db, &customer, 30000)
+
+	w := testRequest(t, PayoutTable, tableParams(table), gin.H{"amount": models.Money(-100), "method": "cash"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var order models.Order
+	if err := db.First(&order, orders[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != models.OrderServed {
+		t.Errorf("order status = %s, want served", order.Status)
+	}
+}
+
+func TestPayoutTableAfterPrepayment(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   models.Money
+		want     int
+		wantOwed models.Money
+	}{
+		{"the rest", 30000, http.StatusOK, 0},
+		{"part of the rest", 10000, http.StatusOK, 20000},
+		{"nothing", 0, http.StatusOK, 30000},
+		{"more than the rest", 30001, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tenantID := testTenantID
+			customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+			mustCreate(t, db, &customer)
+			table, orders := seatTable(t, db, &customer, 30000, 20000)
+			prepay(t, customer, orders[0], 20000)
+
+			w := testRequest(t, PayoutTable, tableParams(table), gin.H{"amount": tt.amount, "method": "cash"})
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Due             models.Money `json:"due"`
+				RemainingCredit models.Money `json:"remaining_credit"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Due != 30000 || resp.RemainingCredit != tt.wantOwed {
+				t.Errorf("due = %s, remaining credit = %s, want 300.00 and %s", resp.Due, resp.RemainingCredit, tt.wantOwed)
+			}
+			if err := db.First(&customer, customer.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if customer.CreditBalance != tt.wantOwed {
+				t.Errorf("credit balance = %s, want %s", customer.CreditBalance, tt.wantOwed)
+			}
+		})
+	}
+}
+
+func TestSplitTableAfterPrepayment(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	ram := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	sita := models.Customer{TenantID: &tenantID, Name: "Sita"}
+	mustCreate(t, db, &ram)
+	mustCreate(t, db, &sita)
+	table, orders := seatTable(t, db, &ram, 30000, 20000)
+	prepay(t, ram, orders[0], 10000)
+
+	// The 400.00 left is split 200.00 each and both pay in full
+	w := testRequest(t, SplitTable, tableParams(table), SplitRequest{
+		Mode:   SplitEqually,
+		Payers: []SplitPayer{{CustomerID: &ram.ID}, {CustomerID: &sita.ID}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Due    models.Money `json:"due"`
+		Payers []SplitShare `json:"payers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Due != 40000 {
+		t.Errorf("due = %s, want 400.00", resp.Due)
+	}
+	for _, share := range resp.Payers {
+		if share.Share != 20000 {
+			t.Errorf("%s's share = %s, want 200.00", share.Name, share.Share)
+		}
+	}
+
+	for _, customer := range []models.Customer{ram, sita} {
+		if err := db.First(&customer, customer.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if customer.CreditBalance != 0 {
+			t.Errorf("%s's credit balance = %s, want 0", customer.Name, customer.CreditBalance)
+		}
+	}
+	for _, order := range orders {
+		if err := db.First(&order, order.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if order.AmountPaid != order.Total {
+			t.Errorf("order %d amount_paid = %s, want %s", order.ID, order.AmountPaid, order.Total)
+		}
+	}
+}
+
+func TestTablesTakeOnlyTheCafesCustomers(t *testing.T) {
+	db := testDB(t)
+	tenantID, otherID := testTenantID, testTenantID+1
+	ram := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	mustCreate(t, db, &ram)
+	foreign := models.Customer{TenantID: &otherID, Name: "Hari", CreditBalance: 500}
+	mustCreate(t, db, &foreign)
+	table, orders := seatTable(t, db, &ram, 30000)
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		body    gin.H
+		want    int
+	}{
+		{"assign other cafe's customer", AssignCustomerToTable, gin.H{"customer_id": foreign.ID, "status": "occupied"}, http.StatusNotFound},
+		{"assign unknown status", AssignCustomerToTable, gin.H{"customer_id": ram.ID, "status": "dirty"}, http.StatusBadRequest},
+		{"update with other cafe's customer", UpdateTable, gin.H{"name": "T1", "customer_id": foreign.ID, "status": "occupied"}, http.StatusNotFound},
+		{"update with unknown status", UpdateTable, gin.H{"name": "T1", "status": ""}, http.StatusBadRequest},
+		{"assign own customer", AssignCustomerToTable, gin.H{"customer_id": ram.ID, "status": "occupied"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := testRequest(t, tt.handler, tableParams(table), tt.body); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	// A foreign customer already on the table is not charged at payout
+	db.Model(&table).Update("customer_id", foreign.ID)
+	if w := testRequest(t, PayoutTable, tableParams(table), gin.H{"amount": models.Money(0), "method": "cash"}); w.Code != http.StatusNotFound {
+		t.Errorf("payout to other cafe's customer: status = %d, want %d: %s", w.Code, http.StatusNotFound, w.Body)
+	}
+	var order models.Order
+	db.First(&order, orders[0].ID)
+	db.First(&foreign, foreign.ID)
+	if order.Status != models.OrderServed || foreign.CreditBalance != 500 {
+		t.Errorf("after refused payout: order %s, foreign balance %s; want served, 5.00", order.Status, foreign.CreditBalance)
+	}
+}
+
+func TestSplitTableChargesOnlyTheCafesCustomers(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	ram := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	legacy := models.Customer{Name: "Hari"}
+	mustCreate(t, db, &ram)
+	mustCreate(t, db, &legacy)
+	table, orders := seatTable(t, db, &ram, 20000)
+
+	w := testRequest(t, SplitTable, tableParams(table), SplitRequest{
+		Mode:   SplitEqually,
+		Payers: []SplitPayer{{CustomerID: &ram.ID}, {CustomerID: &legacy.ID}},
+	})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d, body %s", w.Code, http.StatusNotFound, w.Body)
+	}
+	var order models.Order
+	db.First(&order, orders[0].ID)
+	db.First(&legacy, legacy.ID)
+	if order.Status != models.OrderServed || legacy.CreditBalance != 0 {
+		t.Errorf("after refused split: order %s, legacy balance %s; want served, 0.00", order.Status, legacy.CreditBalance)
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TaxSettings is a cafe's pricing configuration as read and written by the
+// API.
+type TaxSettings struct {
+	TaxInclusive  bool             `json:"tax_inclusive"`
+	ServiceCharge models.Percent   `json:"service_charge"`
+	Rates         []models.TaxRate `json:"rates"`
+}
+
+// loadTaxConfig reads the pricing configuration of a cafe. Rows without a
+// cafe are priced without tax or service charge.
+func loadTaxConfig(tx *gorm.DB, tenantID *uint) (models.TaxConfig, error) {
+	var cfg models.TaxConfig
+	if tenantID == nil {
+		return cfg, nil
+	}
+	var cafe models.Cafe
+	if err := tx.First(&cafe, *tenantID).Error; err != nil {
+		return cfg, err
+	}
+	cfg.Inclusive = cafe.TaxInclusive
+	cfg.ServiceCharge = cafe.ServiceCharge
+	if err := tx.Where("tenant_id = ?", *tenantID).Order("category").Find(&cfg.Rates).Error; err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// repriceOrder recomputes a locked order's discounts, service charge, tax
+// and total from its lines and stores the breakdown. A new total can cover
+// the payments already taken or no longer be covered by them, so whether the
+// order is paid is brought up to date too.
+func repriceOrder(tx *gorm.DB, order *models.Order) error {
+	cfg, err := loadTaxConfig(tx, order.TenantID)
+	if err != nil {
+		return err
+	}
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+
+	discounts := make([]models.Money, len(items))
+	for i, item := range items {
+		discounts[i] = item.Discount
+	}
+	order.Price(items, cfg)
+	for i, item := range items {
+		if item.Discount != discounts[i] {
+			if err := tx.Model(&items[i]).UpdateColumn("discount", item.Discount).Error; err != nil {
+				return err
+			}
+		}
+	}
+	order.Items = items
+
+	if err := tx.Model(order).Select(
+		"subtotal", "discount_total", "discount", "service_charge_percent",
+		"service_charge", "tax_inclusive", "tax_total", "taxes", "total",
+	).Updates(order).Error; err != nil {
+		return err
+	}
+	return syncOrderPaid(tx, order)
+}
+
+// GetTaxSettings returns the current cafe's tax rates and service charge.
+func GetTaxSettings(c *gin.Context) {
+	tenantID := getTenantID(c)
+	if tenantID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select a cafe to view its tax settings"})
+		return
+	}
+	cfg, err := loadTaxConfig(database.DB, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tax settings"})
+		return
+	}
+	if cfg.Rates == nil {
+		cfg.Rates = []models.TaxRate{}
+	}
+
+	c.JSON(http.StatusOK, TaxSettings{
+		TaxInclusive:  cfg.Inclusive,
+		ServiceCharge: cfg.ServiceCharge,
+		Rates:         cfg.Rates,
+	})
+}
+
+// UpdateTaxSettings replaces the current cafe's tax rates and service
+// charge. Open orders pick up the new settings the next time they change;
+// billed orders keep the breakdown they were billed with.
+func UpdateTaxSettings(c *gin.Context) {
+	tenantID := getTenantID(c)
+	if tenantID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select a cafe to configure its taxes"})
+		return
+	}
+
+	var req TaxSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.ServiceCharge.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service charge must be between 0 and 100 percent"})
+		return
+	}
+	seen := map[string]bool{}
+	rates := make([]models.TaxRate, 0, len(req.Rates))
+	for _, r := range req.Rates {
+		if r.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every tax rate needs a name"})
+			return
+		}
+		if !r.Rate.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Rate of %s must be between 0 and 100 percent", r.Name)})
+			return
+		}
+		if seen[r.Category] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Category %q has more than one rate", r.Category)})
+			return
+		}
+		seen[r.Category] = true
+		rates = append(rates, models.TaxRate{
+			TenantID: tenantID,
+			Category: r.Category,
+			Name:     r.Name,
+			Rate:     r.Rate,
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var cafe models.Cafe
+		if err := forUpdate(tx).First(&cafe, *tenantID).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Cafe not found")
+		}
+		before, err := loadTaxConfig(tx, tenantID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&cafe).Updates(map[string]interface{}{
+			"tax_inclusive":  req.TaxInclusive,
+			"service_charge": req.ServiceCharge,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tenant_id = ?", *tenantID).Delete(&models.TaxRate{}).Error; err != nil {
+			return err
+		}
+		if len(rates) > 0 {
+			if err := tx.Create(&rates).Error; err != nil {
+				return err
+			}
+		}
+
+		return recordAudit(tx, c, models.AuditUpdate, "tax_settings", cafe.ID,
+			TaxSettings{TaxInclusive: before.Inclusive, ServiceCharge: before.ServiceCharge, Rates: before.Rates},
+			TaxSettings{TaxInclusive: req.TaxInclusive, ServiceCharge: req.ServiceCharge, Rates: rates})
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update tax settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, TaxSettings{
+		TaxInclusive:  req.TaxInclusive,
+		ServiceCharge: req.ServiceCharge,
+		Rates:         rates,
+	})
+}
+
+// DiscountRequest sets a discount as a percentage or a flat amount. Zero for
+// both removes the discount.
+type DiscountRequest struct {
+	Percent models.Percent `json:"percent"`
+	Amount  models.Money   `json:"amount"`
+	Reason  string         `json:"reason"`
+}
+
+func (r DiscountRequest) validate() error {
+	if r.Percent != 0 && r.Amount != 0 {
+		return fmt.Errorf("give either a percent or an amount, not both")
+	}
+	if !r.Percent.Valid() {
+		return fmt.Errorf("percent must be between 0 and 100")
+	}
+	if r.Amount < 0 {
+		return fmt.Errorf("amount cannot be negative")
+	}
+	return nil
+}
+
+func (r DiscountRequest) columns(c *gin.Context) map[string]interface{} {
+	approvedBy := getActorID(c)
+	if r.Percent == 0 && r.Amount == 0 {
+		approvedBy = nil
+		r.Reason = ""
+	}
+	return map[string]interface{}{
+		"discount_percent":        r.Percent,
+		"discount_flat":           r.Amount,
+		"discount_reason":         r.Reason,
+		"discount_approved_by_id": approvedBy,
+	}
+}
+
+// SetOrderDiscount applies a discount to a whole open order. The discount is
+// recorded as approved by the acting manager.
+func SetOrderDiscount(c *gin.Context) {
+	setDiscount(c, false)
+}
+
+// SetOrderItemDiscount applies a discount to one line of an open order.
+func SetOrderItemDiscount(c *gin.Context) {
+	setDiscount(c, true)
+}
+
+func setDiscount(c *gin.Context, line bool) {
+	var req DiscountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyTenantScope(forUpdate(tx), c).First(&order, c.Param("id")).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Order not found")
+		}
+		for _, closed := range models.ClosedOrderStatuses {
+			if order.Status == closed {
+				return abortTx(http.StatusConflict, fmt.Sprintf("Cannot discount a %s order", order.Status))
+			}
+		}
+		before := order
+
+		if line {
+			var item models.OrderItem
+			if err := forUpdate(tx).Where("order_id = ?", order.ID).First(&item, c.Param("item_id")).Error; err != nil {
+				return abortTx(http.StatusNotFound, "Item not found")
+			}
+			beforeItem := item
+			if err := tx.Model(&item).Updates(req.columns(c)).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, models.AuditUpdate, "order_item", item.ID, beforeItem, item); err != nil {
+				return err
+			}
+		} else {
+			updates := req.columns(c)
+			updates["updated_by_id"] = getActorID(c)
+			if err := tx.Model(&order).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := repriceOrder(tx, &order); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUpdate, "order", order.ID, before, order)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to apply discount")
+		return
+	}
+
+	database.DB.Preload("Table").Preload("Customer").Preload("Items").Preload("Waiter").First(&order, order.ID)
+	c.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiscountCoveringPaymentsMarksOrderPaid(t *testing.T) {
+	db := testDB(t)
+	tenantID := testTenantID
+	mustCreate(t, db, &models.Cafe{ID: testTenantID, Name: "Altia", Subdomain: "altia"})
+	customer := models.Customer{TenantID: &tenantID, Name: "Ram"}
+	mustCreate(t, db, &customer)
+	_, orders := seatTable(t, db, &customer, 10000)
+	order := orders[0]
+	mustCreate(t, db, &models.OrderItem{TenantID: &tenantID, OrderID: order.ID, ItemName: "Momo", Quantity: 1, Price: 10000})
+
+	// 80.00 of the 100.00 is paid; a 20.00 discount leaves nothing due
+	prepay(t, customer, order, 8000)
+	w := testRequest(t, SetOrderDiscount, orderParams(order), gin.H{"amount": models.Money(2000), "reason": "Regular"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("discount status = %d, body %s", w.Code, w.Body)
+	}
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Total != 8000 || order.Due() != 0 || order.PaidAt == nil {
+		t.Errorf("order total %s, due %s, paid at %v; want 80.00, nothing due and paid", order.Total, order.Due(), order.PaidAt)
+	}
+
+	// Removing the discount makes it due again
+	w = testRequest(t, SetOrderDiscount, orderParams(order), gin.H{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("remove discount status = %d, body %s", w.Code, w.Body)
+	}
+	order = models.Order{}
+	db.First(&order, orders[0].ID)
+	if order.Due() != 2000 || order.PaidAt != nil {
+		t.Errorf("order due %s, paid at %v; want 20.00 and unpaid", order.Due(), order.PaidAt)
+	}
+}
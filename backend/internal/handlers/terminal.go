@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPINSessionTTL = 12 * time.Hour
+	maxPINFailures       = 5
+	pinLockout           = 5 * time.Minute
+)
+
+type CreateTerminalRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type PINLoginRequest struct {
+	DeviceToken string `json:"device_token" binding:"required"`
+	UserID      uint   `json:"user_id" binding:"required"`
+	PIN         string `json:"pin" binding:"required"`
+}
+
+type SetPINRequest struct {
+	PIN             string `json:"pin"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// findTerminal looks up a registered terminal by its device token.
+func findTerminal(db *gorm.DB, deviceToken string) (models.Terminal, error) {
+	var terminal models.Terminal
+	err := db.Where("token_hash = ?", hashToken(deviceToken)).First(&terminal).Error
+	return terminal, err
+}
+
+func GetTerminals(c *gin.Context) {
+	var terminals []models.Terminal
+	if err := applyTenantScope(database.DB, c).Order("name").Find(&terminals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch terminals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, terminals)
+}
+
+// CreateTerminal registers a shared device for the current cafe. The device
+// token is returned only in this response and must be stored on the device.
+func CreateTerminal(c *gin.Context) {
+	var req CreateTerminalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID := getTenantID(c)
+	if tenantID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Terminal requires a cafe"})
+		return
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate device token"})
+		return
+	}
+
+	terminal := models.Terminal{
+		TenantID:  tenantID,
+		Name:      req.Name,
+		TokenHash: hash,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&terminal).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "terminal", terminal.ID, nil, terminal)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create terminal"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"terminal":     terminal,
+		"device_token": token,
+	})
+}
+
+// DeleteTerminal unregisters a device and ends every session opened on it.
+func DeleteTerminal(c *gin.Context) {
+	id := c.Param("id")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var terminal models.Terminal
+		if err := applyTenantScope(tx, c).First(&terminal, id).Error; err != nil {
+			return abortTx(http.StatusNotFound, "Terminal not found")
+		}
+		if err := tx.Model(&models.Session{}).
+			Where("terminal_id = ? AND revoked_at IS NULL", terminal.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&terminal).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditDelete, "terminal", terminal.ID, terminal, nil)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to delete terminal")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Terminal deleted successfully"})
+}
+
+// GetTerminalUsers lists the staff who can sign in on a terminal with a PIN,
+// for the user picker on the lock screen. The device token is sent in the
+// X-Device-Token header.
+func GetTerminalUsers(c *gin.Context) {
+	terminal, err := findTerminal(database.DB, c.GetHeader("X-Device-Token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown terminal"})
+		return
+	}
+
+	var users []struct {
+		ID       uint   `json:"id"`
+		FullName string `json:"full_name"`
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := database.DB.Model(&models.User{}).
+		Where("tenant_id = ? AND active = ? AND pin <> ''", terminal.TenantID, true).
+		Order("full_name").
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// PINLogin signs a staff member in on a registered terminal with their PIN.
+// The previous user's session on that terminal is ended, so whatever is rung
+// up next is attributed to whoever just entered their PIN.
+func PINLogin(c *gin.Context) {
+	var req PINLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resp AuthResponse
+	failed := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		terminal, err := findTerminal(tx, req.DeviceToken)
+		if err != nil {
+			return abortTx(http.StatusUnauthorized, "Unknown terminal")
+		}
+
+		var user models.User
+		if err := forUpdate(tx).Where("tenant_id = ?", terminal.TenantID).First(&user, req.UserID).Error; err != nil || !user.Active {
+			return abortTx(http.StatusUnauthorized, "Invalid PIN")
+		}
+
+		now := time.Now()
+		if user.PINLockedUntil != nil && now.Before(*user.PINLockedUntil) {
+			return abortTx(http.StatusTooManyRequests, "Too many failed attempts; try again later")
+		}
+
+		if !user.CheckPIN(req.PIN) {
+			// Count the failure and commit it; lock the PIN after repeated misses
+			updates := map[string]interface{}{"pin_failures": user.PINFailures + 1}
+			if user.PINFailures+1 >= maxPINFailures {
+				updates = map[string]interface{}{"pin_failures": 0, "pin_locked_until": now.Add(pinLockout)}
+			}
+			failed = true
+			return tx.Model(&user).Updates(updates).Error
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"pin_failures":     0,
+			"pin_locked_until": nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Shift switch: end whoever was signed in on this terminal
+		if err := tx.Model(&models.Session{}).
+			Where("terminal_id = ? AND revoked_at IS NULL", terminal.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&terminal).Update("last_seen_at", now).Error; err != nil {
+			return err
+		}
+
+		resp, err = issueSession(tx, c, user, sessionOptions{
+			terminalID: &terminal.ID,
+			expiresAt:  now.Add(tokenTTL("PIN_SESSION_TTL", defaultPINSessionTTL)),
+		})
+		return err
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to sign in")
+		return
+	}
+	if failed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid PIN"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetPIN sets or clears the current user's terminal PIN. The account
+// password is required so a PIN cannot be set from an unattended session.
+func SetPIN(c *gin.Context) {
+	var req SetPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := forUpdate(tx).First(&user, getUserID(c)).Error; err != nil {
+			return abortTx(http.StatusNotFound, "User not found")
+		}
+		if !user.CheckPassword(req.CurrentPassword) {
+			return abortTx(http.StatusUnauthorized, "Current password is incorrect")
+		}
+
+		before := user
+		if err := user.SetPIN(req.PIN); err != nil {
+			if errors.Is(err, models.ErrInvalidPIN) {
+				return abortTx(http.StatusBadRequest, err.Error())
+			}
+			return err
+		}
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"pin":              user.PIN,
+			"pin_failures":     0,
+			"pin_locked_until": nil,
+		}).Error; err != nil {
+			return err
+		}
+		// The PIN itself is never in a snapshot; the event records who
+		// changed it and when
+		return recordAudit(tx, c, models.AuditUpdate, "user", user.ID, before, user)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to set PIN")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "PIN updated"})
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"net/http"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+	FullName string `json:"full_name"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type UpdateUserRequest struct {
+	FullName *string `json:"full_name"`
+	Role     *string `json:"role"`
+	Active   *bool   `json:"active"`
+}
+
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// canManageRole reports whether the current user may grant or edit the role.
+// Only superadmins manage other superadmins.
+func canManageRole(c *gin.Context, role models.UserRole) bool {
+	return role != models.RoleSuperAdmin || models.UserRole(c.GetString("role")) == models.RoleSuperAdmin
+}
+
+// findManagedUser loads a user of the current cafe that the caller may manage.
+func findManagedUser(tx *gorm.DB, c *gin.Context, id string) (models.User, error) {
+	var user models.User
+	if err := platformScope(tx, c).First(&user, id).Error; err != nil {
+		return user, abortTx(http.StatusNotFound, "User not found")
+	}
+	if !canManageRole(c, user.Role) {
+		return user, abortTx(http.StatusForbidden, "Permission denied")
+	}
+	return user, nil
+}
+
+func GetUsers(c *gin.Context) {
+	var users []models.User
+	query := platformScope(database.DB, c).Order("username")
+
+	// Filter by role if provided
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	// Filter by active state if provided
+	if active := c.Query("active"); active != "" {
+		query = query.Where("active = ?", active == "true")
+	}
+
+	if err := query.Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func GetUser(c *gin.Context) {
+	user, err := findManagedUser(database.DB, c, c.Param("id"))
+	if err != nil {
+		respondTxError(c, err, "Failed to fetch user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser adds a staff account to the current cafe with a temporary
+// password that must be changed on first login.
+func CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.UserRole(req.Role)
+	if !role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if !canManageRole(c, role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+		return
+	}
+
+	tenantID := getTenantID(c)
+	if role == models.RoleSuperAdmin {
+		tenantID = nil
+	} else if tenantID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User requires a cafe"})
+		return
+	}
+
+	// Check if user already exists
+	var count int64
+	database.DB.Model(&models.User{}).Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	user := models.User{
+		TenantID:          tenantID,
+		Username:          req.Username,
+		FullName:          req.FullName,
+		Role:              role,
+		Active:            true,
+		MustResetPassword: true,
+	}
+	if err := user.HashPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditCreate, "user", user.ID, nil, user)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser changes name, role or active state. Role changes and
+// deactivation sign the user out so the new state applies immediately.
+func UpdateUser(c *gin.Context) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = findManagedUser(forUpdate(tx), c, c.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		revoke := false
+
+		if req.FullName != nil {
+			updates["full_name"] = *req.FullName
+		}
+		if req.Role != nil && models.UserRole(*req.Role) != user.Role {
+			role := models.UserRole(*req.Role)
+			if !role.Valid() {
+				return abortTx(http.StatusBadRequest, "Unknown role")
+			}
+			if !canManageRole(c, role) {
+				return abortTx(http.StatusForbidden, "Permission denied")
+			}
+			if user.ID == getUserID(c) {
+				return abortTx(http.StatusBadRequest, "You cannot change your own role")
+			}
+			updates["role"] = role
+			revoke = true
+		}
+		if req.Active != nil && *req.Active != user.Active {
+			if user.ID == getUserID(c) {
+				return abortTx(http.StatusBadRequest, "You cannot deactivate your own account")
+			}
+			updates["active"] = *req.Active
+			revoke = revoke || !*req.Active
+		}
+
+		if len(updates) > 0 {
+			before := user
+			if err := tx.Model(&user).Updates(updates).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, models.AuditUpdate, "user", user.ID, before, user); err != nil {
+				return err
+			}
+		}
+		if revoke {
+			return revokeSessions(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ResetUserPassword sets a temporary password, forces the user to change it
+// on next login and signs them out everywhere.
+func ResetUserPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findManagedUser(forUpdate(tx), c, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		before := user
+		if err := user.HashPassword(req.Password); err != nil {
+			return abortTx(http.StatusInternalServerError, "Failed to hash password")
+		}
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":            user.Password,
+			"must_reset_password": true,
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, models.AuditUpdate, "user", user.ID, before, user); err != nil {
+			return err
+		}
+		return revokeSessions(tx, user.ID)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to reset password")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset; the user must choose a new password at next login"})
+}
+
+func DeleteUser(c *gin.Context) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findManagedUser(forUpdate(tx), c, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		if user.ID == getUserID(c) {
+			return abortTx(http.StatusBadRequest, "You cannot delete your own account")
+		}
+		if err := revokeSessions(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditDelete, "user", user.ID, user, nil)
+	})
+	if err != nil {
+		respondTxError(c, err, "Failed to delete user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
@@ -1,9 +1,17 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -13,9 +21,20 @@ type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	TenantID *uint  `json:"tenant_id,omitempty"`
+
+	MustResetPassword bool `json:"must_reset_password,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// passwordResetAllowed lists the routes a user with a pending forced password
+// reset may still call.
+var passwordResetAllowed = map[string]bool{
+	"/api/auth/me":       true,
+	"/api/auth/password": true,
+	"/api/auth/logout":   true,
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -46,23 +65,192 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Access tokens are bound to a server-side session so logout and
+		// revocation take effect before the token expires
+		sessionID, err := strconv.ParseUint(claims.ID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		var session models.Session
+		if err := database.DB.First(&session, uint(sessionID)).Error; err != nil ||
+			session.UserID != claims.UserID || !session.Active(time.Now()) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// A forced password reset only allows changing the password
+		if claims.MustResetPassword && !passwordResetAllowed[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required"})
+			c.Abort()
+			return
+		}
+
+		// Bind the request to the user's cafe. A tenant resolved from the
+		// request must match the token; if none was given, the token's cafe
+		// is used. Platform superadmins may act on any cafe.
+		if models.UserRole(claims.Role) != models.RoleSuperAdmin {
+			tenantID, resolved := TenantID(c)
+			switch {
+			case claims.TenantID == nil && resolved:
+				c.JSON(http.StatusForbidden, gin.H{"error": "User is not assigned to this cafe"})
+				c.Abort()
+				return
+			case claims.TenantID != nil && resolved && tenantID != *claims.TenantID:
+				c.JSON(http.StatusForbidden, gin.H{"error": "User is not assigned to this cafe"})
+				c.Abort()
+				return
+			case claims.TenantID != nil && !resolved:
+				cafe, found, err := lookupCafe(strconv.FormatUint(uint64(*claims.TenantID), 10))
+				if err != nil || !found || !cafe.Active {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Cafe is not available"})
+					c.Abort()
+					return
+				}
+				c.Set(TenantKey, cafe.ID)
+			}
+		}
+
+		if _, resolved := TenantID(c); !resolved && StrictTenancy() &&
+			models.UserRole(claims.Role) != models.RoleSuperAdmin {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tenant not specified"})
+			c.Abort()
+			return
+		}
+
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("session_id", session.ID)
+		if session.TerminalID != nil {
+			c.Set("terminal_id", *session.TerminalID)
+		}
 
 		c.Next()
 	}
 }
 
-func AdminOnly() gin.HandlerFunc {
+// streamTicketTTL is how long a stream ticket may wait to be redeemed.
+const streamTicketTTL = 30 * time.Second
+
+// streamTicket records the authenticated request a ticket was issued to.
+type streamTicket struct {
+	userID     uint
+	username   string
+	role       string
+	sessionID  uint
+	terminalID *uint
+	tenantID   *uint
+	expiresAt  time.Time
+}
+
+var streamTickets = struct {
+	sync.Mutex
+	byToken map[string]streamTicket
+}{byToken: map[string]streamTicket{}}
+
+// IssueStreamTicket returns a single-use ticket that opens one event stream
+// as the current user, for clients that cannot set headers, such as the
+// browser EventSource. Unlike an access token, a ticket in the URL is
+// harmless once it has been used or has expired. It must run after
+// AuthMiddleware.
+func IssueStreamTicket(c *gin.Context) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+
+	ticket := streamTicket{
+		userID:    c.GetUint("user_id"),
+		username:  c.GetString("username"),
+		role:      c.GetString("role"),
+		sessionID: c.GetUint("session_id"),
+		expiresAt: time.Now().Add(streamTicketTTL),
+	}
+	if id, ok := c.Get("terminal_id"); ok {
+		terminalID := id.(uint)
+		ticket.terminalID = &terminalID
+	}
+	if id, ok := TenantID(c); ok {
+		ticket.tenantID = &id
+	}
+
+	streamTickets.Lock()
+	defer streamTickets.Unlock()
+	now := time.Now()
+	for t, issued := range streamTickets.byToken {
+		if now.After(issued.expiresAt) {
+			delete(streamTickets.byToken, t)
+		}
+	}
+	streamTickets.byToken[token] = ticket
+	return token, ticket.expiresAt, nil
+}
+
+// StreamTicketAuth authenticates a request by a ticket from
+// IssueStreamTicket in the ticket query parameter, in place of
+// AuthMiddleware. The ticket is used up, and the session it was issued in
+// must still be active.
+func StreamTicketAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		token := c.Query("ticket")
+		streamTickets.Lock()
+		ticket, found := streamTickets.byToken[token]
+		delete(streamTickets.byToken, token)
+		streamTickets.Unlock()
+		if token == "" || !found || time.Now().After(ticket.expiresAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream ticket"})
+			c.Abort()
+			return
+		}
+
+		var session models.Session
+		if err := database.DB.First(&session, ticket.sessionID).Error; err != nil ||
+			session.UserID != ticket.userID || !session.Active(time.Now()) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
 			c.Abort()
 			return
 		}
+
+		// The stream is of the cafe the ticket was issued for
+		tenantID, resolved := TenantID(c)
+		switch {
+		case resolved && (ticket.tenantID == nil || tenantID != *ticket.tenantID):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Ticket was issued for another cafe"})
+			c.Abort()
+			return
+		case !resolved && ticket.tenantID != nil:
+			c.Set(TenantKey, *ticket.tenantID)
+		}
+
+		c.Set("user_id", ticket.userID)
+		c.Set("username", ticket.username)
+		c.Set("role", ticket.role)
+		c.Set("session_id", ticket.sessionID)
+		if ticket.terminalID != nil {
+			c.Set("terminal_id", *ticket.terminalID)
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission allows the request only if the user's role is granted
+// every listed permission. It must run after AuthMiddleware.
+func RequirePermission(perms ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := models.UserRole(c.GetString("role"))
+		for _, p := range perms {
+			if !role.Can(p) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied: " + string(p)})
+				c.Abort()
+				return
+			}
+		}
 		c.Next()
 	}
 }
@@ -1,33 +1,160 @@
 package middleware
 
 import (
-    "strings"
-    "github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"altia-cafe-backend/internal/database"
+	"altia-cafe-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
 )
 
-// Context key for tenant
+// Context key for tenant. The value stored under it is the cafe ID as a uint.
 const TenantKey = "tenant"
 
-// TenantMiddleware resolves tenant from X-Tenant header or subdomain and injects into context
+// tenantCacheTTL bounds how long a cafe lookup is reused before the database
+// is consulted again, so deactivating a cafe takes effect on every instance.
+const tenantCacheTTL = time.Minute
+
+type tenantCacheEntry struct {
+	cafe    models.Cafe
+	found   bool
+	expires time.Time
+}
+
+var tenantCache = struct {
+	sync.RWMutex
+	entries map[string]tenantCacheEntry
+}{entries: map[string]tenantCacheEntry{}}
+
+// InvalidateTenantCache drops all cached cafe lookups. Call it after a cafe
+// is created, renamed, deactivated or deleted.
+func InvalidateTenantCache() {
+	tenantCache.Lock()
+	tenantCache.entries = map[string]tenantCacheEntry{}
+	tenantCache.Unlock()
+}
+
+// lookupCafe resolves a tenant key, either a numeric cafe ID or a subdomain,
+// to a cafe, caching both hits and misses.
+func lookupCafe(key string) (models.Cafe, bool, error) {
+	now := time.Now()
+
+	tenantCache.RLock()
+	entry, ok := tenantCache.entries[key]
+	tenantCache.RUnlock()
+	if ok && now.Before(entry.expires) {
+		return entry.cafe, entry.found, nil
+	}
+
+	var cafes []models.Cafe
+	query := database.DB.Limit(1)
+	if id, err := strconv.ParseUint(key, 10, 32); err == nil {
+		query = query.Where("id = ?", uint(id))
+	} else {
+		query = query.Where("subdomain = ?", key)
+	}
+	if err := query.Find(&cafes).Error; err != nil {
+		return models.Cafe{}, false, err
+	}
+
+	entry = tenantCacheEntry{found: len(cafes) > 0, expires: now.Add(tenantCacheTTL)}
+	if entry.found {
+		entry.cafe = cafes[0]
+	}
+
+	tenantCache.Lock()
+	tenantCache.entries[key] = entry
+	tenantCache.Unlock()
+
+	return entry.cafe, entry.found, nil
+}
+
+// subdomainFromHost returns the first label of host when it is a subdomain
+// of TENANT_BASE_DOMAIN. Without a base domain no host is taken to name a
+// cafe, since api.example.com would otherwise look like cafe "api".
+func subdomainFromHost(host string) string {
+	base := os.Getenv("TENANT_BASE_DOMAIN")
+	if base == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+
+	sub, ok := strings.CutSuffix(host, "."+base)
+	if !ok || sub == "" || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// tenantlessPath reports whether a request path works without a cafe from
+// the host: the health check and the auth routes, which learn the cafe from
+// the user or device signing in. An explicit X-Tenant header still applies.
+func tenantlessPath(path string) bool {
+	return path == "/health" || strings.HasPrefix(path, "/api/auth/")
+}
+
+// TenantMiddleware resolves the cafe from the X-Tenant header (ID or
+// subdomain) or the request subdomain under TENANT_BASE_DOMAIN and injects
+// its ID into the context.
+// Unknown and inactive cafes are rejected.
 func TenantMiddleware() gin.HandlerFunc {
-    return func(c *gin.Context) {
-        tenant := c.Request.Header.Get("X-Tenant")
-        if tenant == "" {
-            host := c.Request.Host
-            // Try to parse subdomain: subdomain.example.com
-            parts := strings.Split(host, ".")
-            if len(parts) > 2 {
-                tenant = parts[0]
-            }
-        }
-
-        if tenant == "" {
-            // Optional: block if tenant missing
-            // c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Tenant not specified"})
-            // return
-        }
-
-        c.Set(TenantKey, tenant)
-        c.Next()
-    }
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.Request.Header.Get("X-Tenant"))
+		if key == "" && !tenantlessPath(c.Request.URL.Path) {
+			key = subdomainFromHost(c.Request.Host)
+		}
+
+		if key == "" {
+			// No tenant: requests run unscoped (development mode)
+			c.Next()
+			return
+		}
+
+		cafe, found, err := lookupCafe(strings.ToLower(key))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve tenant"})
+			return
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Cafe not found"})
+			return
+		}
+		if !cafe.Active {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Cafe is inactive"})
+			return
+		}
+
+		c.Set(TenantKey, cafe.ID)
+		c.Next()
+	}
+}
+
+// StrictTenancy reports whether TENANT_STRICT is enabled. In strict mode every
+// protected request must resolve to a cafe and rows without a tenant are
+// never visible.
+func StrictTenancy() bool {
+	strict, _ := strconv.ParseBool(os.Getenv("TENANT_STRICT"))
+	return strict
+}
+
+// TenantID returns the resolved cafe ID for the request, if any.
+func TenantID(c *gin.Context) (uint, bool) {
+	if t, ok := c.Get(TenantKey); ok {
+		if id, ok := t.(uint); ok {
+			return id, true
+		}
+	}
+	return 0, false
 }
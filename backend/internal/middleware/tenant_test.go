@@ -0,0 +1,47 @@
+package middleware
+
+import "testing"
+
+func TestSubdomainFromHost(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		host string
+		want string
+	}{
+		{"no base domain", "", "altia.example.com", ""},
+		{"no base domain api host", "", "api.example.com:8080", ""},
+		{"cafe subdomain", "example.com", "altia.example.com", "altia"},
+		{"cafe subdomain with port", "example.com", "altia.example.com:8080", "altia"},
+		{"base domain itself", "example.com", "example.com", ""},
+		{"nested subdomain", "example.com", "a.b.example.com", ""},
+		{"other domain", "example.com", "altia.other.com", ""},
+		{"ip address", "example.com", "127.0.0.1:8080", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TENANT_BASE_DOMAIN", tt.base)
+			if got := subdomainFromHost(tt.host); got != tt.want {
+				t.Errorf("subdomainFromHost(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantlessPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/health", true},
+		{"/api/auth/login", true},
+		{"/api/auth/me", true},
+		{"/api/orders", false},
+		{"/api/authx", false},
+	}
+	for _, tt := range tests {
+		if got := tenantlessPath(tt.path); got != tt.want {
+			t.Errorf("tenantlessPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+)
+
+// JSON is a raw JSON document stored in a jsonb column.
+type JSON []byte
+
+// Value stores the document as text so Postgres can cast it to jsonb.
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan reads a jsonb column.
+func (j *JSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[:0], v...)
+	case string:
+		*j = JSON(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSON", value)
+	}
+	return nil
+}
+
+// MarshalJSON embeds the document as-is.
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// UnmarshalJSON keeps a copy of the raw document.
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[:0], data...)
+	return nil
+}
+
+// AuditEvent records one mutation: who did what to which record, with JSON
+// snapshots of the record before and after. Events are append-only.
+type AuditEvent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	TenantID  *uint       `gorm:"index" json:"tenant_id,omitempty"`
+	UserID    *uint       `gorm:"index" json:"user_id,omitempty"`
+	Entity    string      `gorm:"type:varchar(50);not null;index:idx_audit_entity" json:"entity"`
+	EntityID  uint        `gorm:"not null;index:idx_audit_entity" json:"entity_id"`
+	Action    AuditAction `gorm:"type:varchar(20);not null" json:"action"`
+	Before    JSON        `gorm:"type:jsonb" json:"before"`
+	After     JSON        `gorm:"type:jsonb" json:"after"`
+	IPAddress string      `json:"ip_address"`
+}
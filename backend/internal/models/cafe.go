@@ -14,4 +14,9 @@ type Cafe struct {
     Name      string `gorm:"not null" json:"name"`
     Subdomain string `gorm:"uniqueIndex;not null" json:"subdomain"`
     Active    bool   `gorm:"default:true" json:"active"`
+
+    // Pricing: whether menu prices include tax, and the service charge
+    // added to every order. Tax rates are kept as TaxRate rows.
+    TaxInclusive  bool    `gorm:"not null;default:false" json:"tax_inclusive"`
+    ServiceCharge Percent `gorm:"not null;default:0" json:"service_charge"`
 }
@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+type CashSessionStatus string
+
+const (
+	CashSessionOpen   CashSessionStatus = "open"
+	CashSessionClosed CashSessionStatus = "closed"
+)
+
+// CashPaymentMethod is the Payment.Method of payments that go into the till.
+const CashPaymentMethod = "cash"
+
+// CashSession is one user's shift on a terminal's cash drawer. It opens with
+// a float; the cash it should hold at close is the float plus the cash
+// payments taken in it and any cash paid in, less cash refunds and cash
+// paid out. The difference from the counted cash is the variance.
+type CashSession struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	TenantID *uint `gorm:"index" json:"tenant_id,omitempty"`
+	// A terminal and a user each have at most one open session
+	TerminalID uint              `gorm:"not null;index;uniqueIndex:idx_cash_sessions_open_terminal,where:status = 'open'" json:"terminal_id"`
+	Terminal   *Terminal         `gorm:"foreignKey:TerminalID" json:"terminal,omitempty"`
+	UserID     uint              `gorm:"not null;index;uniqueIndex:idx_cash_sessions_open_user,where:status = 'open'" json:"user_id"`
+	User       *User             `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Status     CashSessionStatus `gorm:"type:varchar(20);not null;default:'open';index" json:"status"`
+
+	OpenedAt     time.Time `gorm:"not null" json:"opened_at"`
+	OpeningFloat Money     `gorm:"not null;default:0" json:"opening_float"`
+
+	// Filled in when the drawer is counted at close
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	ClosedByID   *uint      `json:"closed_by_id,omitempty"`
+	ExpectedCash Money      `gorm:"not null;default:0" json:"expected_cash"`
+	CountedCash  *Money     `json:"counted_cash,omitempty"`
+	Variance     Money      `gorm:"not null;default:0" json:"variance"`
+	Notes        string     `json:"notes"`
+
+	Movements []CashMovement `gorm:"foreignKey:CashSessionID" json:"movements,omitempty"`
+}
+
+type CashMovementType string
+
+const (
+	CashIn  CashMovementType = "cash_in"
+	CashOut CashMovementType = "cash_out"
+)
+
+// CashMovement is cash put into or taken out of a drawer other than by a
+// payment, such as change brought in or a supplier paid from the till.
+// Amount is always positive.
+type CashMovement struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TenantID      *uint            `gorm:"index" json:"tenant_id,omitempty"`
+	CashSessionID uint             `gorm:"not null;index" json:"cash_session_id"`
+	Type          CashMovementType `gorm:"type:varchar(20);not null" json:"type"`
+	Amount        Money            `gorm:"not null" json:"amount"`
+	Reason        string           `json:"reason"`
+	CreatedByID   *uint            `json:"created_by_id,omitempty"`
+}
+
+// Signed returns the movement's effect on the drawer.
+func (m CashMovement) Signed() Money {
+	if m.Type == CashOut {
+		return m.Amount.Neg()
+	}
+	return m.Amount
+}
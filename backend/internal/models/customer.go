@@ -12,10 +12,11 @@ type Customer struct {
 	UpdatedAt     time.Time      `json:"updated_at"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 
-	TenantID      *uint          `gorm:"index" json:"tenant_id,omitempty"`
+	// Phones are unique within a cafe among live customers that have one
+	TenantID      *uint          `gorm:"index;uniqueIndex:idx_customers_tenant_phone,priority:1" json:"tenant_id,omitempty"`
 	Name          string         `gorm:"not null" json:"name"`
-	Phone         string         `gorm:"uniqueIndex" json:"phone"`
-	CreditBalance float64        `gorm:"default:0" json:"credit_balance"`
+	Phone         string         `gorm:"uniqueIndex:idx_customers_tenant_phone,priority:2,where:phone <> '' AND deleted_at IS NULL" json:"phone"`
+	CreditBalance Money          `gorm:"default:0" json:"credit_balance"`
 	Orders        []Order        `gorm:"foreignKey:CustomerID" json:"orders,omitempty"`
 	Payments      []Payment      `gorm:"foreignKey:CustomerID" json:"payments,omitempty"`
 }
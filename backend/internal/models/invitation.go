@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation lets an admin onboard a staff member into a cafe with a fixed
+// role. Only the SHA-256 hash of the invite token is stored; the token itself
+// is shown once when the invitation is created.
+type Invitation struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	TenantID    *uint      `gorm:"index" json:"tenant_id,omitempty"`
+	TokenHash   string     `gorm:"uniqueIndex;not null" json:"-"`
+	Role        UserRole   `gorm:"type:varchar(20);not null" json:"role"`
+	FullName    string     `json:"full_name"`
+	CreatedByID uint       `gorm:"not null" json:"created_by_id"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	UserID      *uint      `json:"user_id,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Pending reports whether the invitation can still be redeemed.
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
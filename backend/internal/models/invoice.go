@@ -0,0 +1,30 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Invoice gives a billed order or a payment its receipt number. Numbers run
+// per cafe without gaps and are issued in the transaction that bills the
+// order or records the payment, together with what the customer charged or
+// paying owed after it, so every print of the receipt shows the same number
+// and balance. An order charged to several customers records no balance.
+type Invoice struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TenantID  *uint `gorm:"uniqueIndex:idx_invoices_number" json:"tenant_id,omitempty"`
+	Number    uint  `gorm:"not null;uniqueIndex:idx_invoices_number" json:"number"`
+	OrderID   *uint `gorm:"uniqueIndex" json:"order_id,omitempty"`
+	PaymentID *uint `gorm:"uniqueIndex" json:"payment_id,omitempty"`
+
+	// CustomerID is whose balance Balance is; nil when there is none
+	CustomerID *uint `gorm:"index" json:"customer_id,omitempty"`
+	Balance    Money `gorm:"not null;default:0" json:"balance"`
+}
+
+// Code is the invoice number as printed, e.g. INV-000042.
+func (i Invoice) Code() string {
+	return fmt.Sprintf("INV-%06d", i.Number)
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+type LedgerEntryType string
+
+const (
+	LedgerCharge     LedgerEntryType = "charge"
+	LedgerPayment    LedgerEntryType = "payment"
+	LedgerAdjustment LedgerEntryType = "adjustment"
+	LedgerRefund     LedgerEntryType = "refund"
+	LedgerWriteOff   LedgerEntryType = "write_off"
+)
+
+// LedgerEntry records one change to a customer's credit balance. Amount is
+// signed from the cafe's side: positive entries increase what the customer
+// owes, negative entries reduce it. Entries are never updated or deleted, and
+// Customer.CreditBalance always equals the sum of a customer's entries.
+type LedgerEntry struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	TenantID   *uint           `gorm:"index" json:"tenant_id,omitempty"`
+	CustomerID uint            `gorm:"not null;index" json:"customer_id"`
+	Type       LedgerEntryType `gorm:"type:varchar(20);not null" json:"type"`
+	Amount     Money           `gorm:"not null" json:"amount"`
+	OrderID    *uint           `gorm:"index" json:"order_id,omitempty"`
+	PaymentID  *uint           `gorm:"index" json:"payment_id,omitempty"`
+	Notes      string          `json:"notes"`
+}
@@ -6,6 +6,24 @@ import (
 	"gorm.io/gorm"
 )
 
+// Station is where a menu item is prepared and whose display shows it.
+type Station string
+
+const (
+	StationKitchen Station = "kitchen"
+	StationBar     Station = "bar"
+	StationBarista Station = "barista"
+)
+
+// Valid reports whether s is a known station.
+func (s Station) Valid() bool {
+	switch s {
+	case StationKitchen, StationBar, StationBarista:
+		return true
+	}
+	return false
+}
+
 type MenuItem struct {
 	ID          uint           `gorm:"primarykey" json:"id"`
 	CreatedAt   time.Time      `json:"created_at"`
@@ -15,7 +33,8 @@ type MenuItem struct {
 	TenantID    *uint          `gorm:"index" json:"tenant_id,omitempty"`
 	Name        string         `gorm:"not null" json:"name"`
 	Category    string         `json:"category"`
-	Price       float64        `gorm:"not null" json:"price"`
+	Price       Money          `gorm:"not null" json:"price"`
 	Description string         `json:"description"`
 	Available   bool           `gorm:"default:true" json:"available"`
+	Station     Station        `gorm:"type:varchar(20);not null;default:'kitchen'" json:"station"`
 }
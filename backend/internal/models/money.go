@@ -0,0 +1,189 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MinorUnits is the number of minor units (paisa/cents) in one major unit.
+const MinorUnits = 100
+
+// Money is an amount stored as an integer number of minor units so that
+// totals and balances add up exactly. It is written to JSON as a decimal
+// number of major units (e.g. 150.50) to stay compatible with API clients.
+type Money int64
+
+// FromMajor converts a whole number of major units (rupees/dollars) to Money.
+func FromMajor(units int64) Money {
+	return Money(units * MinorUnits)
+}
+
+// ParseMoney parses a decimal string of major units such as "150.5" or
+// "-20". Digits beyond the minor unit are rounded half away from zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid money value %q", s)
+		}
+		// Converting a float outside the int64 range is undefined
+		minor := math.Round(f * MinorUnits)
+		if math.IsNaN(minor) || minor >= math.MaxInt64 || minor < math.MinInt64 {
+			return 0, fmt.Errorf("money value %q is out of range", s)
+		}
+		return Money(minor), nil
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	// strconv.ParseInt below would take a second sign
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+
+	var minor int64
+	for i := 0; i < len(frac); i++ {
+		d := frac[i]
+		if d < '0' || d > '9' {
+			return 0, fmt.Errorf("invalid money value %q", s)
+		}
+		switch {
+		case i < 2:
+			minor = minor*10 + int64(d-'0')
+		case i == 2 && d >= '5':
+			minor++
+		}
+	}
+	// Pad a single fractional digit: "150.5" is 50 paisa, not 5.
+	if len(frac) == 1 {
+		minor *= 10
+	}
+
+	if units > (math.MaxInt64-minor)/MinorUnits {
+		return 0, fmt.Errorf("money value %q is out of range", s)
+	}
+	m := Money(units*MinorUnits + minor)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+// Add returns m + o.
+func (m Money) Add(o Money) Money {
+	return m + o
+}
+
+// Sub returns m - o.
+func (m Money) Sub(o Money) Money {
+	return m - o
+}
+
+// Mul returns m multiplied by a whole quantity.
+func (m Money) Mul(qty int) Money {
+	return m * Money(qty)
+}
+
+// Neg returns -m.
+func (m Money) Neg() Money {
+	return -m
+}
+
+// Float64 returns the amount in major units. Use it only for display.
+func (m Money) Float64() float64 {
+	return float64(m) / MinorUnits
+}
+
+// String formats the amount in major units with two decimals.
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/MinorUnits, v%MinorUnits)
+}
+
+// MarshalJSON writes the amount as a decimal number of major units.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or numeric string in major units.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value stores the amount as an integer number of minor units.
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads an integer number of minor units. Aggregates such as SUM come
+// back from Postgres as numeric, so string and float values are accepted too.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = Money(math.Round(v))
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	// Stored values are already minor units, so parse as a plain number and
+	// round away any fractional part produced by AVG or numeric casts.
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money", s)
+	}
+	*m = Money(math.Round(f))
+	return nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"150", 15000, false},
+		{"150.5", 15050, false},
+		{"150.50", 15050, false},
+		{"0.05", 5, false},
+		{".5", 50, false},
+		{"5.", 500, false},
+		{"+1.2", 120, false},
+		{"-20", -2000, false},
+		{"  3.10 ", 310, false},
+		{"1e2", 10000, false},
+
+		// Digits past the paisa round half away from zero
+		{"150.504", 15050, false},
+		{"150.505", 15051, false},
+		{"0.995", 100, false},
+		{"-0.005", -1, false},
+		{"-0.004", 0, false},
+
+		{"", 0, true},
+		{"-", 0, true},
+		{".", 0, true},
+		{"abc", 0, true},
+		{"1,50", 0, true},
+		{"1.2.3", 0, true},
+		{"1.5x", 0, true},
+		{"--5", 0, true},
+		{"-+5", 0, true},
+		{"+-5", 0, true},
+		{"1.-5", 0, true},
+		{"92233720368547758.07", math.MaxInt64, false},
+		{"-92233720368547758.07", -math.MaxInt64, false},
+		{"92233720368547758.08", 0, true},
+		{"92233720368547759", 0, true},
+		{"99999999999999999999", 0, true},
+		{"1e20", 0, true},
+		{"-1e20", 0, true},
+		{"1e400", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{15050, "150.50"},
+		{-5, "-0.05"},
+		{-15000, "-150.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{`150.5`, 15050, false},
+		{`"99.99"`, 9999, false},
+		{`-0.25`, -25, false},
+		{`0`, 0, false},
+		{`12.345`, 1235, false},
+		{`"abc"`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var got struct {
+				Amount Money `json:"amount"`
+			}
+			err := json.Unmarshal([]byte(`{"amount":`+tt.in+`}`), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unmarshal %s error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got.Amount != tt.want {
+				t.Errorf("unmarshal %s = %d, want %d", tt.in, got.Amount, tt.want)
+			}
+		})
+	}
+
+	// null leaves the amount as it was
+	v := struct {
+		Amount Money `json:"amount"`
+	}{Amount: 700}
+	if err := json.Unmarshal([]byte(`{"amount":null}`), &v); err != nil || v.Amount != 700 {
+		t.Errorf("unmarshal null = %d, %v, want 700", v.Amount, err)
+	}
+
+	data, err := json.Marshal(map[string]Money{"a": 15050, "b": -5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"a":150.50,"b":-0.05}`; got != want {
+		t.Errorf("marshal = %s, want %s", got, want)
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -9,11 +11,56 @@ import (
 type OrderStatus string
 
 const (
-	OrderPending OrderStatus = "pending"
-	OrderServed  OrderStatus = "served"
-	OrderBilled  OrderStatus = "billed"
+	OrderPending   OrderStatus = "pending"
+	OrderPreparing OrderStatus = "preparing"
+	OrderReady     OrderStatus = "ready"
+	OrderServed    OrderStatus = "served"
+	OrderBilled    OrderStatus = "billed"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderVoid      OrderStatus = "void"
 )
 
+// orderTransitions lists the statuses each status may move to. Orders move
+// forward through the kitchen and may skip steps; an open order can be
+// cancelled, and a billed order can only be voided. Cancelled and void are
+// final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:   {OrderPreparing, OrderReady, OrderServed, OrderBilled, OrderCancelled},
+	OrderPreparing: {OrderReady, OrderServed, OrderBilled, OrderCancelled},
+	OrderReady:     {OrderServed, OrderBilled, OrderCancelled},
+	OrderServed:    {OrderBilled, OrderCancelled},
+	OrderBilled:    {OrderVoid},
+	OrderCancelled: {},
+	OrderVoid:      {},
+}
+
+// ClosedOrderStatuses are the statuses of orders no longer open on a table.
+var ClosedOrderStatuses = []OrderStatus{OrderBilled, OrderCancelled, OrderVoid}
+
+// ErrUnknownOrderStatus is returned by Transition for statuses outside the
+// state machine.
+var ErrUnknownOrderStatus = errors.New("unknown order status")
+
+// ErrIllegalTransition is returned by Transition when the order cannot move
+// to the requested status from its current one.
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// Valid reports whether s is a known order status.
+func (s OrderStatus) Valid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// CanTransition reports whether an order in status s may move to next.
+func (s OrderStatus) CanTransition(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type Order struct {
 	ID         uint           `gorm:"primarykey" json:"id"`
 	CreatedAt  time.Time      `json:"created_at"`
@@ -27,23 +74,159 @@ type Order struct {
 	Customer   Customer       `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
 	Items      []OrderItem    `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items"`
 	Status     OrderStatus    `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
-	Total      float64        `json:"total"`
+	Total      Money          `json:"total"`
 	Notes      string         `json:"notes"`
+
+	// Breakdown of Total, worked out by Price. Subtotal is before any
+	// discount; DiscountTotal covers line and order discounts.
+	Subtotal             Money     `gorm:"not null;default:0" json:"subtotal"`
+	DiscountTotal        Money     `gorm:"not null;default:0" json:"discount_total"`
+	ServiceChargePercent Percent   `gorm:"not null;default:0" json:"service_charge_percent"`
+	ServiceCharge        Money     `gorm:"not null;default:0" json:"service_charge"`
+	TaxInclusive         bool      `gorm:"not null;default:false" json:"tax_inclusive"`
+	TaxTotal             Money     `gorm:"not null;default:0" json:"tax_total"`
+	Taxes                []TaxLine `gorm:"type:jsonb;serializer:json" json:"taxes"`
+
+	// Order-level discount: a percentage or a flat amount, approved by a
+	// manager. Discount is the amount it came to.
+	DiscountPercent      Percent `gorm:"not null;default:0" json:"discount_percent"`
+	DiscountFlat         Money   `gorm:"not null;default:0" json:"discount_flat"`
+	Discount             Money   `gorm:"not null;default:0" json:"discount"`
+	DiscountReason       string  `json:"discount_reason,omitempty"`
+	DiscountApprovedByID *uint   `json:"discount_approved_by_id,omitempty"`
+
+	// Payments taken against the order, net of refunds. PaidAt is set while
+	// they cover the total.
+	AmountPaid Money      `gorm:"not null;default:0" json:"amount_paid"`
+	PaidAt     *time.Time `json:"paid_at,omitempty"`
+
+	// Staff attribution: who rang the order up, who last changed it, and
+	// the waiter responsible for the table
+	CreatedByID *uint `gorm:"index" json:"created_by_id,omitempty"`
+	UpdatedByID *uint `gorm:"index" json:"updated_by_id,omitempty"`
+	WaiterID    *uint `gorm:"index" json:"waiter_id,omitempty"`
+	Waiter      *User `gorm:"foreignKey:WaiterID" json:"waiter,omitempty"`
+
+	// When the order entered each status; CreatedAt covers pending
+	PreparingAt *time.Time `json:"preparing_at,omitempty"`
+	ReadyAt     *time.Time `json:"ready_at,omitempty"`
+	ServedAt    *time.Time `json:"served_at,omitempty"`
+	BilledAt    *time.Time `json:"billed_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	VoidedAt    *time.Time `json:"voided_at,omitempty"`
+}
+
+// Due is what is left to pay on the order: its total less the payments
+// taken against it, never below zero.
+func (o Order) Due() Money {
+	if o.AmountPaid >= o.Total {
+		return 0
+	}
+	return o.Total.Sub(o.AmountPaid)
 }
 
+// Transition moves the order to next, stamping the time it entered the
+// status, and returns the columns to persist. It returns
+// ErrUnknownOrderStatus or ErrIllegalTransition without changing the order.
+func (o *Order) Transition(next OrderStatus, at time.Time) (map[string]interface{}, error) {
+	if !next.Valid() {
+		return nil, fmt.Errorf("%w %q", ErrUnknownOrderStatus, next)
+	}
+	if !o.Status.CanTransition(next) {
+		return nil, fmt.Errorf("%w from %s to %s", ErrIllegalTransition, o.Status, next)
+	}
+
+	var column string
+	switch next {
+	case OrderPreparing:
+		o.PreparingAt, column = &at, "preparing_at"
+	case OrderReady:
+		o.ReadyAt, column = &at, "ready_at"
+	case OrderServed:
+		o.ServedAt, column = &at, "served_at"
+	case OrderBilled:
+		o.BilledAt, column = &at, "billed_at"
+	case OrderCancelled:
+		o.CancelledAt, column = &at, "cancelled_at"
+	case OrderVoid:
+		o.VoidedAt, column = &at, "voided_at"
+	}
+	o.Status = next
+
+	updates := map[string]interface{}{"status": next}
+	if column != "" {
+		updates[column] = at
+	}
+	return updates, nil
+}
+
+// OrderItemStatus tracks a line through its station: queued until someone
+// starts it, then cooking, ready for pickup and finally served.
+type OrderItemStatus string
+
+const (
+	ItemQueued  OrderItemStatus = "queued"
+	ItemCooking OrderItemStatus = "cooking"
+	ItemReady   OrderItemStatus = "ready"
+	ItemServed  OrderItemStatus = "served"
+)
+
+// itemFlow is the order in which a line moves through its station.
+var itemFlow = []OrderItemStatus{ItemQueued, ItemCooking, ItemReady, ItemServed}
+
+// Next returns the status a bump moves to, or false if s is the last one.
+func (s OrderItemStatus) Next() (OrderItemStatus, bool) {
+	for i, status := range itemFlow {
+		if status == s && i+1 < len(itemFlow) {
+			return itemFlow[i+1], true
+		}
+	}
+	return s, false
+}
+
+// Previous returns the status a recall moves back to, or false if s is the
+// first one.
+func (s OrderItemStatus) Previous() (OrderItemStatus, bool) {
+	for i, status := range itemFlow {
+		if status == s && i > 0 {
+			return itemFlow[i-1], true
+		}
+	}
+	return s, false
+}
+
+// OrderItem is a line on an order. ItemName, Price and Station are
+// snapshotted from the referenced MenuItem when the line is created so later
+// menu edits do not change what was charged or where it is prepared.
 type OrderItem struct {
-	ID        uint      `gorm:"primarykey" json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	TenantID  *uint     `gorm:"index" json:"tenant_id,omitempty"`
-	OrderID   uint      `gorm:"not null" json:"order_id"`
-	ItemName  string    `gorm:"not null" json:"item_name"`
-	Quantity  int       `gorm:"not null;default:1" json:"quantity"`
-	Price     float64   `gorm:"not null" json:"price"`
-	Subtotal  float64   `json:"subtotal"`
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	TenantID   *uint     `gorm:"index" json:"tenant_id,omitempty"`
+	OrderID    uint      `gorm:"not null" json:"order_id"`
+	MenuItemID *uint     `gorm:"index" json:"menu_item_id,omitempty"`
+	ItemName   string    `gorm:"not null" json:"item_name"`
+	Quantity   int       `gorm:"not null;default:1" json:"quantity"`
+	Price      Money     `gorm:"not null" json:"price"`
+	Subtotal   Money     `json:"subtotal"`
+	Category   string    `json:"category"`
+
+	CreatedByID *uint `gorm:"index" json:"created_by_id,omitempty"`
+
+	// Line discount, approved by a manager; Discount is the amount it came to
+	DiscountPercent      Percent `gorm:"not null;default:0" json:"discount_percent"`
+	DiscountFlat         Money   `gorm:"not null;default:0" json:"discount_flat"`
+	Discount             Money   `gorm:"not null;default:0" json:"discount"`
+	DiscountReason       string  `json:"discount_reason,omitempty"`
+	DiscountApprovedByID *uint   `json:"discount_approved_by_id,omitempty"`
+
+	// Preparation on the kitchen display
+	Station         Station         `gorm:"type:varchar(20);not null;default:'kitchen';index" json:"station"`
+	Status          OrderItemStatus `gorm:"type:varchar(20);not null;default:'queued';index" json:"status"`
+	StatusChangedAt *time.Time      `json:"status_changed_at,omitempty"`
 }
 
 // BeforeSave calculates subtotal for order items
 func (oi *OrderItem) BeforeSave(tx *gorm.DB) error {
-	oi.Subtotal = float64(oi.Quantity) * oi.Price
+	oi.Subtotal = oi.Price.Mul(oi.Quantity)
 	return nil
 }
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOrderTransition(t *testing.T) {
+	tests := []struct {
+		from    OrderStatus
+		to      OrderStatus
+		column  string
+		wantErr error
+	}{
+		{OrderPending, OrderPreparing, "preparing_at", nil},
+		{OrderPending, OrderServed, "served_at", nil},
+		{OrderPending, OrderBilled, "billed_at", nil},
+		{OrderPending, OrderCancelled, "cancelled_at", nil},
+		{OrderPreparing, OrderReady, "ready_at", nil},
+		{OrderReady, OrderServed, "served_at", nil},
+		{OrderServed, OrderBilled, "billed_at", nil},
+		{OrderServed, OrderCancelled, "cancelled_at", nil},
+		{OrderBilled, OrderVoid, "voided_at", nil},
+
+		// Backwards, out of final states and skipping billing
+		{OrderPreparing, OrderPending, "", ErrIllegalTransition},
+		{OrderServed, OrderReady, "", ErrIllegalTransition},
+		{OrderBilled, OrderCancelled, "", ErrIllegalTransition},
+		{OrderBilled, OrderServed, "", ErrIllegalTransition},
+		{OrderCancelled, OrderPending, "", ErrIllegalTransition},
+		{OrderCancelled, OrderBilled, "", ErrIllegalTransition},
+		{OrderVoid, OrderBilled, "", ErrIllegalTransition},
+		{OrderPending, OrderVoid, "", ErrIllegalTransition},
+		{OrderServed, OrderServed, "", ErrIllegalTransition},
+
+		{OrderPending, "completed", "", ErrUnknownOrderStatus},
+		{OrderPending, "", "", ErrUnknownOrderStatus},
+	}
+	at := time.Date(2026, 10, 17, 12, 30, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			order := Order{Status: tt.from}
+			updates, err := order.Transition(tt.to, at)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if updates != nil || order.Status != tt.from {
+					t.Errorf("order changed on error: status %s, updates %v", order.Status, updates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if order.Status != tt.to || updates["status"] != tt.to {
+				t.Errorf("status = %s, updates %v, want %s", order.Status, updates, tt.to)
+			}
+			if got, ok := updates[tt.column].(time.Time); !ok || !got.Equal(at) {
+				t.Errorf("updates[%q] = %v, want %v", tt.column, updates[tt.column], at)
+			}
+			if len(updates) != 2 {
+				t.Errorf("updates = %v, want status and %s only", updates, tt.column)
+			}
+		})
+	}
+}
+
+func TestOrderTransitionStampsStatusTime(t *testing.T) {
+	at := time.Date(2026, 10, 17, 12, 30, 0, 0, time.UTC)
+	order := Order{Status: OrderPending}
+	if _, err := order.Transition(OrderBilled, at); err != nil {
+		t.Fatal(err)
+	}
+	if order.BilledAt == nil || !order.BilledAt.Equal(at) {
+		t.Errorf("BilledAt = %v, want %v", order.BilledAt, at)
+	}
+	if _, err := order.Transition(OrderVoid, at.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if order.VoidedAt == nil || !order.VoidedAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("VoidedAt = %v, want %v", order.VoidedAt, at.Add(time.Hour))
+	}
+	if !order.BilledAt.Equal(at) {
+		t.Errorf("voiding moved BilledAt to %v", order.BilledAt)
+	}
+}
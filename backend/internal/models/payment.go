@@ -17,7 +17,47 @@ type Payment struct {
 	Customer   Customer       `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
 	OrderID    *uint          `json:"order_id,omitempty"`
 	Order      *Order         `gorm:"foreignKey:OrderID" json:"order,omitempty"`
-	Amount     float64        `gorm:"not null" json:"amount"`
+	Amount     Money          `gorm:"not null" json:"amount"`
 	Method     string         `gorm:"default:'cash'" json:"method"`
 	Notes      string         `json:"notes"`
+
+	// CashSessionID is the cash drawer shift the payment was taken in, or a
+	// refund paid out of
+	CashSessionID *uint `gorm:"index" json:"cash_session_id,omitempty"`
+
+	// A refund is a negative payment linked to the payment it refunds, which
+	// itself is left as it was
+	RefundOfID *uint     `gorm:"index" json:"refund_of_id,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Refunds    []Payment `gorm:"foreignKey:RefundOfID" json:"refunds,omitempty"`
+
+	CreatedByID *uint `gorm:"index" json:"created_by_id,omitempty"`
+	UpdatedByID *uint `gorm:"index" json:"updated_by_id,omitempty"`
+}
+
+// AllocatePayment divides a payment between amounts due, paying each in
+// turn before the next. Whatever exceeds the total due goes to the last
+// part, so the parts always add up to amount.
+func AllocatePayment(amount Money, due []Money) []Money {
+	parts := make([]Money, len(due))
+	if len(due) == 0 {
+		return parts
+	}
+	left := amount
+	for i, d := range due {
+		if left <= 0 {
+			break
+		}
+		if d <= 0 {
+			continue
+		}
+		part := d
+		if part > left {
+			part = left
+		}
+		parts[i] = part
+		left = left.Sub(part)
+	}
+	parts[len(parts)-1] = parts[len(parts)-1].Add(left)
+	return parts
 }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocatePayment(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Money
+		due    []Money
+		want   []Money
+	}{
+		{"nothing due", 100, nil, []Money{}},
+		{"exact", 30000, []Money{10000, 20000}, []Money{10000, 20000}},
+		{"first paid before the next", 15000, []Money{10000, 20000}, []Money{10000, 5000}},
+		{"within the first", 4000, []Money{10000, 20000}, []Money{4000, 0}},
+		{"excess to the last", 40000, []Money{10000, 20000}, []Money{10000, 30000}},
+		{"settled parts skipped", 10000, []Money{0, 10000}, []Money{0, 10000}},
+		{"overpaid parts skipped", 10000, []Money{-500, 10000, 500}, []Money{0, 10000, 0}},
+		{"all settled", 10000, []Money{0, 0}, []Money{0, 10000}},
+		{"zero amount", 0, []Money{10000}, []Money{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AllocatePayment(tt.amount, tt.due)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AllocatePayment(%d, %v) = %v, want %v", tt.amount, tt.due, got, tt.want)
+			}
+			var sum Money
+			for _, part := range got {
+				sum += part
+			}
+			if len(got) > 0 && sum != tt.amount {
+				t.Errorf("parts add up to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
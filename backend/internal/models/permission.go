@@ -0,0 +1,130 @@
+package models
+
+// Permission names an action a role may perform.
+type Permission string
+
+const (
+	PermMenuView       Permission = "menu.view"
+	PermMenuWrite      Permission = "menu.write"
+	PermTableView      Permission = "table.view"
+	PermTableWrite     Permission = "table.write"
+	PermTableServe     Permission = "table.serve"
+	PermCustomerView   Permission = "customer.view"
+	PermCustomerWrite  Permission = "customer.write"
+	PermCustomerDelete Permission = "customer.delete"
+	PermOrderView      Permission = "order.view"
+	PermOrderWrite     Permission = "order.write"
+	PermOrderDelete    Permission = "order.delete"
+	PermPaymentView    Permission = "payment.view"
+	PermPaymentCreate  Permission = "payment.create"
+	PermReportsView    Permission = "reports.view"
+	PermUserManage     Permission = "user.manage"
+	PermTerminalManage Permission = "terminal.manage"
+	PermCafeManage     Permission = "cafe.manage"
+	PermAuditView      Permission = "audit.view"
+	PermKDSUse         Permission = "kds.use"
+
+	// Pricing: approving discounts and setting tax rates
+	PermDiscountApprove Permission = "discount.approve"
+	PermTaxManage       Permission = "tax.manage"
+
+	// Closing the business day with a Z-report
+	PermReportsClose Permission = "reports.close"
+
+	// Cash drawer shifts: running one's own drawer and reconciling anyone's
+	PermCashDrawer    Permission = "cash.drawer"
+	PermCashReconcile Permission = "cash.reconcile"
+
+	// Refunding part or all of a payment
+	PermPaymentRefund Permission = "payment.refund"
+
+	// Adjusting or writing off a customer's credit balance
+	PermLedgerAdjust Permission = "ledger.adjust"
+
+	// Billing or voiding an order by changing its status directly
+	PermOrderSettle Permission = "order.settle"
+)
+
+// frontdeskPermissions run the floor: seat guests, take orders and payments.
+var frontdeskPermissions = []Permission{
+	PermMenuView,
+	PermTableView,
+	PermTableServe,
+	PermCustomerView,
+	PermCustomerWrite,
+	PermOrderView,
+	PermOrderWrite,
+	PermPaymentView,
+	PermPaymentCreate,
+	PermCashDrawer,
+	PermKDSUse,
+}
+
+// managerPermissions add menu, layout, deletions, discounts and reports on
+// top of the front desk.
+var managerPermissions = append([]Permission{
+	PermMenuWrite,
+	PermDiscountApprove,
+	PermTableWrite,
+	PermCustomerDelete,
+	PermOrderDelete,
+	PermOrderSettle,
+	PermPaymentRefund,
+	PermLedgerAdjust,
+	PermReportsView,
+	PermReportsClose,
+	PermCashReconcile,
+	PermTerminalManage,
+}, frontdeskPermissions...)
+
+// rolePermissions is the permission matrix. Superadmins are allowed
+// everything and are not listed.
+var rolePermissions = map[UserRole][]Permission{
+	RoleAdmin:     append([]Permission{PermUserManage, PermAuditView, PermTaxManage}, managerPermissions...),
+	RoleManager:   managerPermissions,
+	RoleFrontdesk: frontdeskPermissions,
+	RoleWaiter: {
+		PermMenuView,
+		PermTableView,
+		PermTableServe,
+		PermCustomerView,
+		PermOrderView,
+		PermOrderWrite,
+		PermKDSUse,
+	},
+	RoleKitchen: {
+		PermMenuView,
+		PermOrderView,
+		PermKDSUse,
+	},
+}
+
+// Can reports whether the role is granted the permission.
+func (r UserRole) Can(p Permission) bool {
+	if r == RoleSuperAdmin {
+		return true
+	}
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions lists everything the role is granted.
+func (r UserRole) Permissions() []Permission {
+	if r == RoleSuperAdmin {
+		return append([]Permission{PermCafeManage}, rolePermissions[RoleAdmin]...)
+	}
+	return rolePermissions[r]
+}
+
+// Valid reports whether r is a known role.
+func (r UserRole) Valid() bool {
+	if r == RoleSuperAdmin {
+		return true
+	}
+	_, ok := rolePermissions[r]
+	return ok
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// BusinessDate is the layout of business day dates, e.g. 2024-03-31.
+const BusinessDate = "2006-01-02"
+
+// SalesTotals adds up billed orders.
+type SalesTotals struct {
+	Orders        int   `gorm:"not null;default:0" json:"orders"`
+	Subtotal      Money `gorm:"not null;default:0" json:"subtotal"`
+	Discounts     Money `gorm:"not null;default:0" json:"discounts"`
+	ServiceCharge Money `gorm:"not null;default:0" json:"service_charge"`
+	Tax           Money `gorm:"not null;default:0" json:"tax"`
+	Sales         Money `gorm:"not null;default:0" json:"sales"`
+}
+
+// Add counts a billed order in the totals.
+func (t *SalesTotals) Add(o Order) {
+	t.Orders++
+	t.Subtotal = t.Subtotal.Add(o.Subtotal)
+	t.Discounts = t.Discounts.Add(o.DiscountTotal)
+	t.ServiceCharge = t.ServiceCharge.Add(o.ServiceCharge)
+	t.Tax = t.Tax.Add(o.TaxTotal)
+	t.Sales = t.Sales.Add(o.Total)
+}
+
+// MethodTotal adds up the payments taken with one payment method. Amount is
+// net of refunds, which are also totalled on their own.
+type MethodTotal struct {
+	Method   string `json:"method"`
+	Payments int    `json:"payments"`
+	Amount   Money  `json:"amount"`
+	Refunds  Money  `json:"refunds"`
+}
+
+// CreditTotals sums customer ledger entries over a period. Extended is what
+// was charged to accounts and Collected what was paid against them;
+// Adjustments covers voids, manual adjustments, refunds and write-offs. Net
+// is the change in what customers owe.
+type CreditTotals struct {
+	Extended    Money `gorm:"not null;default:0" json:"extended"`
+	Collected   Money `gorm:"not null;default:0" json:"collected"`
+	Adjustments Money `gorm:"not null;default:0" json:"adjustments"`
+	Net         Money `gorm:"not null;default:0" json:"net"`
+}
+
+// Add counts a ledger entry in the totals.
+func (t *CreditTotals) Add(e LedgerEntry) {
+	switch e.Type {
+	case LedgerCharge:
+		t.Extended = t.Extended.Add(e.Amount)
+	case LedgerPayment:
+		t.Collected = t.Collected.Sub(e.Amount)
+	default:
+		t.Adjustments = t.Adjustments.Add(e.Amount)
+	}
+	t.Net = t.Net.Add(e.Amount)
+}
+
+// ZReport closes a cafe's business day. Its totals are taken when the day is
+// closed and never change; billing, payments and voids that would alter a
+// closed day are refused.
+type ZReport struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TenantID     *uint  `gorm:"uniqueIndex:idx_z_reports_day" json:"tenant_id,omitempty"`
+	BusinessDate string `gorm:"type:varchar(10);not null;uniqueIndex:idx_z_reports_day" json:"business_date"`
+	ClosedByID   *uint  `json:"closed_by_id,omitempty"`
+
+	SalesTotals   `gorm:"embedded"`
+	Voids         int           `gorm:"not null;default:0" json:"voids"`
+	VoidedAmount  Money         `gorm:"not null;default:0" json:"voided_amount"`
+	Payments      []MethodTotal `gorm:"type:jsonb;serializer:json" json:"payments"`
+	PaymentsTotal Money         `gorm:"not null;default:0" json:"payments_total"`
+	Credit        CreditTotals  `gorm:"embedded;embeddedPrefix:credit_" json:"credit"`
+	// Orders still open when the day was closed
+	OpenOrders int `gorm:"not null;default:0" json:"open_orders"`
+}
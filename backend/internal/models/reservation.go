@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationBooked    ReservationStatus = "booked"
+	ReservationSeated    ReservationStatus = "seated"
+	ReservationNoShow    ReservationStatus = "no_show"
+	ReservationCancelled ReservationStatus = "cancelled"
+)
+
+// ActiveReservationStatuses are the statuses that hold a reservation's
+// tables for its time window.
+var ActiveReservationStatuses = []ReservationStatus{ReservationBooked, ReservationSeated}
+
+// Reservation books one or more tables for a customer or walk-in guest over
+// a time window. Active reservations on the same table may not overlap.
+type Reservation struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	TenantID   *uint             `gorm:"index" json:"tenant_id,omitempty"`
+	CustomerID *uint             `gorm:"index" json:"customer_id,omitempty"`
+	Customer   *Customer         `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	GuestName  string            `json:"guest_name"`
+	GuestPhone string            `json:"guest_phone"`
+	PartySize  int               `gorm:"not null" json:"party_size"`
+	StartsAt   time.Time         `gorm:"not null;index" json:"starts_at"`
+	EndsAt     time.Time         `gorm:"not null;index" json:"ends_at"`
+	Status     ReservationStatus `gorm:"type:varchar(20);not null;default:'booked';index" json:"status"`
+	Notes      string            `json:"notes"`
+	Tables     []Table           `gorm:"many2many:reservation_tables" json:"tables"`
+
+	CreatedByID *uint      `gorm:"index" json:"created_by_id,omitempty"`
+	UpdatedByID *uint      `gorm:"index" json:"updated_by_id,omitempty"`
+	SeatedAt    *time.Time `json:"seated_at,omitempty"`
+}
+
+// Booked reports whether the reservation is still waiting for its guests.
+func (r *Reservation) Booked() bool {
+	return r.Status == ReservationBooked
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a server-side login backing a rotating refresh token. Access
+// tokens carry the session ID, so revoking a session also invalidates the
+// access tokens issued for it. Only the SHA-256 hash of the refresh token is
+// stored.
+type Session struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	TenantID     *uint      `gorm:"index" json:"tenant_id,omitempty"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID *uint      `json:"replaced_by_id,omitempty"`
+	TerminalID   *uint      `gorm:"index" json:"terminal_id,omitempty"`
+	UserAgent    string     `json:"user_agent"`
+	IPAddress    string     `json:"ip_address"`
+}
+
+// Active reports whether the session can still be used.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -14,6 +14,15 @@ const (
 	TableReserved TableStatus = "reserved"
 )
 
+// Valid reports whether s is a known table status.
+func (s TableStatus) Valid() bool {
+	switch s {
+	case TableFree, TableOccupied, TableReserved:
+		return true
+	}
+	return false
+}
+
 type Table struct {
 	ID         uint           `gorm:"primarykey" json:"id"`
 	CreatedAt  time.Time      `json:"created_at"`
@@ -31,4 +40,24 @@ type Table struct {
 	Customer   *Customer      `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
 	GuestName  string         `json:"guest_name"`
 	GuestPhone string         `json:"guest_phone"`
+	Seats      int            `gorm:"not null;default:4" json:"seats"`
+
+	// BillGroupID links merged tables that are billed together
+	BillGroupID *uint `gorm:"index" json:"bill_group_id,omitempty"`
+
+	CreatedByID  *uint `gorm:"index" json:"created_by_id,omitempty"`
+	UpdatedByID  *uint `gorm:"index" json:"updated_by_id,omitempty"`
+	AssignedByID *uint `json:"assigned_by_id,omitempty"` // who seated the current guest
+}
+
+// BillGroup joins tables whose orders are settled as one bill. It is closed
+// when the group is paid out.
+type BillGroup struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TenantID    *uint      `gorm:"index" json:"tenant_id,omitempty"`
+	Tables      []Table    `gorm:"foreignKey:BillGroupID" json:"tables,omitempty"`
+	CreatedByID *uint      `json:"created_by_id,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
 }
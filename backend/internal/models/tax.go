@@ -0,0 +1,254 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Percent is a rate stored in hundredths of a percent (basis points), so
+// 13% is 1300. Like Money it is written to JSON as a decimal, e.g. 13.00.
+type Percent int64
+
+// ParsePercent parses a decimal percentage such as "13" or "12.5".
+func ParsePercent(s string) (Percent, error) {
+	m, err := ParseMoney(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage %q", strings.TrimSpace(s))
+	}
+	return Percent(m), nil
+}
+
+// Of returns p percent of m, rounded half away from zero.
+func (p Percent) Of(m Money) Money {
+	return divRound(int64(m)*int64(p), 100*100)
+}
+
+// Valid reports whether p is between 0% and 100%.
+func (p Percent) Valid() bool {
+	return p >= 0 && p <= 100*100
+}
+
+// String formats the rate with two decimals.
+func (p Percent) String() string {
+	return Money(p).String()
+}
+
+// MarshalJSON writes the rate as a decimal number of percent.
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or numeric string of percent.
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	v, err := ParsePercent(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// Value stores the rate in basis points.
+func (p Percent) Value() (driver.Value, error) {
+	return int64(p), nil
+}
+
+// Scan reads a rate in basis points.
+func (p *Percent) Scan(value interface{}) error {
+	var m Money
+	if err := m.Scan(value); err != nil {
+		return err
+	}
+	*p = Percent(m)
+	return nil
+}
+
+// divRound divides a by b, rounding half away from zero. b must be positive.
+func divRound(a, b int64) Money {
+	if a < 0 {
+		return -Money((-a + b/2) / b)
+	}
+	return Money((a + b/2) / b)
+}
+
+// Allocate divides a non-negative total in proportion to weights. The parts
+// always add up to total; rounding leftovers go one minor unit at a time to
+// the largest weights. With no positive weight everything goes to the first
+// part.
+func Allocate(total Money, weights []Money) []Money {
+	parts := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+	var sum Money
+	var order []int
+	for i, w := range weights {
+		if w > 0 {
+			sum += w
+			order = append(order, i)
+		}
+	}
+	if sum == 0 {
+		parts[0] = total
+		return parts
+	}
+
+	left := total
+	for _, i := range order {
+		parts[i] = Money(int64(total) * int64(weights[i]) / int64(sum))
+		left -= parts[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool { return weights[order[a]] > weights[order[b]] })
+	for k := 0; left > 0; k++ {
+		parts[order[k%len(order)]]++
+		left--
+	}
+	return parts
+}
+
+// TaxRate is a cafe's tax on one menu category. The rate with an empty
+// category applies to every category without a rate of its own.
+type TaxRate struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	TenantID *uint   `gorm:"index" json:"tenant_id,omitempty"`
+	Category string  `gorm:"not null;default:''" json:"category"`
+	Name     string  `gorm:"not null" json:"name"`
+	Rate     Percent `gorm:"not null" json:"rate"`
+}
+
+// TaxConfig is how a cafe prices its orders.
+type TaxConfig struct {
+	// Inclusive means menu prices already contain tax
+	Inclusive     bool
+	ServiceCharge Percent
+	Rates         []TaxRate
+}
+
+// rateFor returns the tax rate of a menu category, if any.
+func (cfg TaxConfig) rateFor(category string) (TaxRate, bool) {
+	var fallback *TaxRate
+	for i, r := range cfg.Rates {
+		if r.Category == category {
+			return r, true
+		}
+		if r.Category == "" {
+			fallback = &cfg.Rates[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return TaxRate{}, false
+}
+
+// TaxLine is the tax collected at one rate on an order.
+type TaxLine struct {
+	Name    string  `json:"name"`
+	Rate    Percent `json:"rate"`
+	Taxable Money   `json:"taxable"`
+	Amount  Money   `json:"amount"`
+}
+
+// Discount is a percentage or flat amount taken off an order or a line. A
+// non-zero Percent wins over Flat.
+type Discount struct {
+	Percent Percent `json:"percent"`
+	Flat    Money   `json:"amount"`
+}
+
+// Apply returns the discount on base, never more than base itself.
+func (d Discount) Apply(base Money) Money {
+	off := d.Flat
+	if d.Percent != 0 {
+		off = d.Percent.Of(base)
+	}
+	if off > base {
+		off = base
+	}
+	if off < 0 {
+		off = 0
+	}
+	return off
+}
+
+// Price works out the order's breakdown from its lines and the cafe's tax
+// configuration: line and order discounts, service charge and tax per rate.
+// Line discounts are stored on the lines. Service charge is levied on the
+// discounted amount and is not taxed. With inclusive pricing the tax is
+// contained in the discounted amount; otherwise it is added on top.
+func (o *Order) Price(items []OrderItem, cfg TaxConfig) {
+	o.Subtotal = 0
+	o.DiscountTotal = 0
+	o.TaxInclusive = cfg.Inclusive
+
+	nets := make([]Money, len(items))
+	var net Money
+	for i := range items {
+		items[i].Discount = Discount{
+			Percent: items[i].DiscountPercent,
+			Flat:    items[i].DiscountFlat,
+		}.Apply(items[i].Subtotal)
+		nets[i] = items[i].Subtotal.Sub(items[i].Discount)
+		o.Subtotal = o.Subtotal.Add(items[i].Subtotal)
+		o.DiscountTotal = o.DiscountTotal.Add(items[i].Discount)
+		net = net.Add(nets[i])
+	}
+
+	// Spread the order discount over the lines so each is taxed on what is
+	// actually charged for it
+	o.Discount = Discount{Percent: o.DiscountPercent, Flat: o.DiscountFlat}.Apply(net)
+	o.DiscountTotal = o.DiscountTotal.Add(o.Discount)
+	for i, part := range Allocate(o.Discount, nets) {
+		nets[i] = nets[i].Sub(part)
+	}
+	net = net.Sub(o.Discount)
+
+	o.Taxes = []TaxLine{}
+	index := map[string]int{}
+	for i, item := range items {
+		rate, ok := cfg.rateFor(item.Category)
+		if !ok || rate.Rate == 0 {
+			continue
+		}
+		key := rate.Name + "|" + rate.Rate.String()
+		j, seen := index[key]
+		if !seen {
+			o.Taxes = append(o.Taxes, TaxLine{Name: rate.Name, Rate: rate.Rate})
+			j = len(o.Taxes) - 1
+			index[key] = j
+		}
+		o.Taxes[j].Taxable = o.Taxes[j].Taxable.Add(nets[i])
+	}
+
+	o.TaxTotal = 0
+	for i, line := range o.Taxes {
+		if cfg.Inclusive {
+			// Taxable holds the gross amount; take out the tax inside it
+			gross := line.Taxable
+			line.Taxable = divRound(int64(gross)*100*100, 100*100+int64(line.Rate))
+			line.Amount = gross.Sub(line.Taxable)
+		} else {
+			line.Amount = line.Rate.Of(line.Taxable)
+		}
+		o.Taxes[i] = line
+		o.TaxTotal = o.TaxTotal.Add(line.Amount)
+	}
+
+	o.ServiceChargePercent = cfg.ServiceCharge
+	o.ServiceCharge = cfg.ServiceCharge.Of(net)
+
+	o.Total = net.Add(o.ServiceCharge)
+	if !cfg.Inclusive {
+		o.Total = o.Total.Add(o.TaxTotal)
+	}
+}
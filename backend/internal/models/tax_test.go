@@ -0,0 +1,173 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   Money
+		weights []Money
+		want    []Money
+	}{
+		{"no parts", 100, nil, []Money{}},
+		{"exact", 300, []Money{1, 2}, []Money{100, 200}},
+		{"remainder to the largest weight", 7, []Money{1, 2}, []Money{2, 5}},
+		{"remainder spread over equal weights in order", 100, []Money{1, 1, 1}, []Money{34, 33, 33}},
+		{"remainder larger than one paisa", 5, []Money{1, 1, 1}, []Money{2, 2, 1}},
+		{"all remainder", 1, []Money{1, 1, 1}, []Money{1, 0, 0}},
+		{"zero weights skipped", 10, []Money{0, 5, 5}, []Money{0, 5, 5}},
+		{"negative weights skipped", 10, []Money{-5, 10}, []Money{0, 10}},
+		{"no positive weight", 10, []Money{0, 0}, []Money{10, 0}},
+		{"nothing to allocate", 0, []Money{3, 4}, []Money{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Allocate(tt.total, tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+			}
+			var sum Money
+			for _, part := range got {
+				sum += part
+			}
+			if len(got) > 0 && sum != tt.total {
+				t.Errorf("parts add up to %d, want %d", sum, tt.total)
+			}
+		})
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		rate Percent
+		of   Money
+		want Money
+	}{
+		{1300, 10000, 1300},
+		{1250, 999, 125}, // 124.875 rounds up
+		{1000, 5, 1},     // 0.5 rounds away from zero
+		{1000, -5, -1},
+		{0, 10000, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.rate.Of(tt.of); got != tt.want {
+			t.Errorf("%s%% of %d = %d, want %d", tt.rate, tt.of, got, tt.want)
+		}
+	}
+}
+
+func TestOrderPrice(t *testing.T) {
+	vat := []TaxRate{{Name: "VAT", Rate: 1300}}
+	tests := []struct {
+		name  string
+		items []OrderItem
+		order Order
+		cfg   TaxConfig
+		want  Order
+		taxes []TaxLine
+	}{
+		{
+			name:  "no tax",
+			items: []OrderItem{{Subtotal: 30000}},
+			want:  Order{Subtotal: 30000, Total: 30000},
+			taxes: []TaxLine{},
+		},
+		{
+			name:  "exclusive tax added on top",
+			items: []OrderItem{{Subtotal: 30000}},
+			cfg:   TaxConfig{Rates: vat},
+			want:  Order{Subtotal: 30000, TaxTotal: 3900, Total: 33900},
+			taxes: []TaxLine{{Name: "VAT", Rate: 1300, Taxable: 30000, Amount: 3900}},
+		},
+		{
+			name:  "inclusive tax taken out of the price",
+			items: []OrderItem{{Subtotal: 11300}},
+			cfg:   TaxConfig{Inclusive: true, Rates: vat},
+			want:  Order{Subtotal: 11300, TaxInclusive: true, TaxTotal: 1300, Total: 11300},
+			taxes: []TaxLine{{Name: "VAT", Rate: 1300, Taxable: 10000, Amount: 1300}},
+		},
+		{
+			name:  "service charge is not taxed",
+			items: []OrderItem{{Subtotal: 30000}},
+			cfg:   TaxConfig{ServiceCharge: 1000, Rates: vat},
+			want:  Order{Subtotal: 30000, ServiceChargePercent: 1000, ServiceCharge: 3000, TaxTotal: 3900, Total: 36900},
+			taxes: []TaxLine{{Name: "VAT", Rate: 1300, Taxable: 30000, Amount: 3900}},
+		},
+		{
+			name: "line and order discounts before tax",
+			items: []OrderItem{
+				{Subtotal: 10000, DiscountPercent: 1000},
+				{Subtotal: 5000},
+			},
+			order: Order{DiscountFlat: 1400},
+			cfg:   TaxConfig{Rates: vat},
+			// The order discount is spread 900/500 over the lines' 9000/5000
+			want:  Order{Subtotal: 15000, DiscountFlat: 1400, Discount: 1400, DiscountTotal: 2400, TaxTotal: 1638, Total: 14238},
+			taxes: []TaxLine{{Name: "VAT", Rate: 1300, Taxable: 12600, Amount: 1638}},
+		},
+		{
+			name: "category rates",
+			items: []OrderItem{
+				{Subtotal: 10000, Category: "food"},
+				{Subtotal: 5000, Category: "drinks"},
+				{Subtotal: 2000, Category: "food"},
+			},
+			cfg: TaxConfig{Rates: []TaxRate{
+				{Category: "food", Name: "VAT", Rate: 1300},
+				{Category: "drinks", Name: "Excise", Rate: 500},
+			}},
+			want: Order{Subtotal: 17000, TaxTotal: 1810, Total: 18810},
+			taxes: []TaxLine{
+				{Name: "VAT", Rate: 1300, Taxable: 12000, Amount: 1560},
+				{Name: "Excise", Rate: 500, Taxable: 5000, Amount: 250},
+			},
+		},
+		{
+			name:  "discount capped at the amount",
+			items: []OrderItem{{Subtotal: 5000}},
+			order: Order{DiscountFlat: 99999},
+			cfg:   TaxConfig{Rates: vat},
+			want:  Order{Subtotal: 5000, DiscountFlat: 99999, Discount: 5000, DiscountTotal: 5000, Total: 0},
+			taxes: []TaxLine{{Name: "VAT", Rate: 1300}},
+		},
+		{
+			name:  "rounding of a percentage discount",
+			items: []OrderItem{{Subtotal: 333}, {Subtotal: 333}, {Subtotal: 333}},
+			order: Order{DiscountPercent: 1000},
+			// 10% of 9.99 is 1.00 after rounding; the lines share it 34/33/33
+			want:  Order{Subtotal: 999, DiscountPercent: 1000, Discount: 100, DiscountTotal: 100, Total: 899},
+			taxes: []TaxLine{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := tt.order
+			order.Price(tt.items, tt.cfg)
+			if !reflect.DeepEqual(order.Taxes, tt.taxes) {
+				t.Errorf("taxes = %+v, want %+v", order.Taxes, tt.taxes)
+			}
+			order.Taxes, tt.want.Taxes = nil, nil
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Errorf("priced order = %+v\nwant %+v", order, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderPriceStoresLineDiscounts(t *testing.T) {
+	items := []OrderItem{
+		{Subtotal: 10000, DiscountPercent: 1250},
+		{Subtotal: 5000, DiscountFlat: 700},
+		{Subtotal: 300, DiscountFlat: 500},
+	}
+	var order Order
+	order.Price(items, TaxConfig{})
+	for i, want := range []Money{1250, 700, 300} {
+		if items[i].Discount != want {
+			t.Errorf("line %d discount = %d, want %d", i, items[i].Discount, want)
+		}
+	}
+}
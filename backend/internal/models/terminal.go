@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Terminal is a registered shared device, such as the front-desk tablet.
+// Staff sign in on it with their PIN; the device proves itself with a token
+// of which only the SHA-256 hash is stored.
+type Terminal struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	TenantID   *uint      `gorm:"index" json:"tenant_id,omitempty"`
+	Name       string     `gorm:"not null" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -11,7 +12,13 @@ type UserRole string
 
 const (
 	RoleAdmin     UserRole = "admin"
+	RoleManager   UserRole = "manager"
 	RoleFrontdesk UserRole = "frontdesk"
+	RoleWaiter    UserRole = "waiter"
+	RoleKitchen   UserRole = "kitchen"
+	// RoleSuperAdmin is a platform operator who is not bound to a cafe and
+	// may act on any of them.
+	RoleSuperAdmin UserRole = "superadmin"
 )
 
 type User struct {
@@ -25,8 +32,21 @@ type User struct {
 	Password  string         `gorm:"not null" json:"-"`
 	Role      UserRole       `gorm:"type:varchar(20);not null;default:'frontdesk'" json:"role"`
 	FullName  string         `json:"full_name"`
+
+	// Active is false for disabled accounts, which cannot log in
+	Active bool `gorm:"not null;default:true" json:"active"`
+	// MustResetPassword forces a password change before any other request
+	MustResetPassword bool `gorm:"not null;default:false" json:"must_reset_password"`
+
+	// PIN is the bcrypt hash of an optional short PIN for terminal logins
+	PIN            string     `json:"-"`
+	PINFailures    int        `gorm:"not null;default:0" json:"-"`
+	PINLockedUntil *time.Time `json:"-"`
 }
 
+// ErrInvalidPIN is returned by SetPIN for PINs that are not 4 to 6 digits.
+var ErrInvalidPIN = errors.New("PIN must be 4 to 6 digits")
+
 // HashPassword hashes the user password
 func (u *User) HashPassword(password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -42,3 +62,33 @@ func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
+
+// SetPIN hashes and stores a 4 to 6 digit PIN. An empty PIN clears it.
+func (u *User) SetPIN(pin string) error {
+	if pin == "" {
+		u.PIN = ""
+		return nil
+	}
+	if len(pin) < 4 || len(pin) > 6 {
+		return ErrInvalidPIN
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return ErrInvalidPIN
+		}
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PIN = string(hashed)
+	return nil
+}
+
+// CheckPIN verifies the PIN. Users without a PIN never match.
+func (u *User) CheckPIN(pin string) bool {
+	if u.PIN == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PIN), []byte(pin)) == nil
+}
@@ -0,0 +1,172 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ESC/POS control sequences used on receipts
+var (
+	escInit        = []byte{0x1b, 0x40}
+	escAlignLeft   = []byte{0x1b, 0x61, 0}
+	escAlignCenter = []byte{0x1b, 0x61, 1}
+	escBoldOn      = []byte{0x1b, 0x45, 1}
+	escBoldOff     = []byte{0x1b, 0x45, 0}
+	escDoubleSize  = []byte{0x1d, 0x21, 0x11}
+	escNormalSize  = []byte{0x1d, 0x21, 0}
+	escFeedAndCut  = []byte{0x1d, 0x56, 66, 3}
+)
+
+// DefaultColumns fits font A on 80 mm paper; 58 mm printers take 32.
+const DefaultColumns = 48
+
+// ESCPOS renders the receipt as a raw byte stream for a thermal printer that
+// prints columns characters per line. The paper is cut at the end.
+func ESCPOS(r Receipt, columns int) []byte {
+	if columns <= 0 {
+		columns = DefaultColumns
+	}
+	p := &printer{columns: columns}
+
+	p.write(escInit)
+	p.write(escAlignCenter)
+	p.write(escBoldOn, escDoubleSize)
+	p.line(r.CafeName)
+	p.write(escNormalSize)
+	p.line(r.Title)
+	p.write(escBoldOff)
+	if r.Invoice != "" {
+		p.line("Invoice " + r.Invoice)
+	}
+	p.line(r.IssuedAt.Format("2006-01-02 15:04"))
+	p.write(escAlignLeft)
+	p.rule()
+
+	if r.Table != "" {
+		p.row("Table", r.Table)
+	}
+	if r.Customer != "" {
+		p.row("Customer", r.Customer)
+	}
+	if r.Staff != "" {
+		p.row("Served by", r.Staff)
+	}
+
+	if len(r.Lines) > 0 {
+		p.rule()
+		for _, l := range r.Lines {
+			p.wrapped(l.Name)
+			p.row(fmt.Sprintf("  %d x %s", l.Quantity, l.Price), l.Amount.String())
+			if l.Discount != 0 {
+				p.row("  Discount", "-"+l.Discount.String())
+			}
+		}
+	}
+
+	if r.HasBreakdown() {
+		p.rule()
+		p.row("Subtotal", amount(r.Subtotal))
+		if r.Discount != 0 {
+			p.row("Discount", "-"+amount(r.Discount))
+		}
+		if r.ServiceCharge != 0 {
+			p.row(fmt.Sprintf("Service charge %s%%", r.ServiceRate), amount(r.ServiceCharge))
+		}
+		for _, t := range r.Taxes {
+			label := fmt.Sprintf("%s %s%%", t.Name, t.Rate)
+			if r.TaxInclusive {
+				label += " (incl.)"
+			}
+			p.row(label, amount(t.Amount))
+		}
+		p.write(escBoldOn)
+		p.row("TOTAL", amount(r.Total))
+		p.write(escBoldOff)
+	}
+
+	if len(r.Payments) > 0 {
+		p.rule()
+		for _, pay := range r.Payments {
+			p.row("Paid ("+pay.Method+")", amount(pay.Amount))
+		}
+	}
+	if r.Balance != nil {
+		p.write(escBoldOn)
+		p.row("Balance owed", amount(*r.Balance))
+		p.write(escBoldOff)
+	}
+
+	if len(r.Notes) > 0 {
+		p.rule()
+		for _, n := range r.Notes {
+			p.wrapped(n)
+		}
+	}
+
+	p.rule()
+	p.write(escAlignCenter)
+	p.line("Thank you!")
+	p.write(escFeedAndCut)
+	return p.buf.Bytes()
+}
+
+type printer struct {
+	buf     bytes.Buffer
+	columns int
+}
+
+func (p *printer) write(seqs ...[]byte) {
+	for _, s := range seqs {
+		p.buf.Write(s)
+	}
+}
+
+func (p *printer) line(s string) {
+	p.buf.WriteString(ascii(s))
+	p.buf.WriteByte('\n')
+}
+
+func (p *printer) rule() {
+	p.line(strings.Repeat("-", p.columns))
+}
+
+// row prints left and right aligned text on one line, wrapping the left part
+// when both do not fit.
+func (p *printer) row(left, right string) {
+	left, right = ascii(left), ascii(right)
+	gap := p.columns - len(left) - len(right)
+	if gap < 1 {
+		p.line(left)
+		gap = p.columns - len(right)
+		left = ""
+		if gap < 0 {
+			gap = 0
+		}
+	}
+	p.line(left + strings.Repeat(" ", gap) + right)
+}
+
+// wrapped prints text over as many lines as it needs.
+func (p *printer) wrapped(s string) {
+	s = ascii(s)
+	for len(s) > p.columns {
+		cut := strings.LastIndex(s[:p.columns], " ")
+		if cut <= 0 {
+			cut = p.columns
+		}
+		p.line(s[:cut])
+		s = strings.TrimLeft(s[cut:], " ")
+	}
+	p.line(s)
+}
+
+// ascii replaces what the printer's code page cannot show.
+func ascii(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '?'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,123 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PDF renders the receipt as an A5 document.
+func PDF(r Receipt) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A5", "")
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 12)
+	pdf.SetTitle(strings.TrimSpace(r.Title+" "+r.Invoice), false)
+	pdf.AddPage()
+
+	// The core fonts are Latin-1 only
+	text := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - 24
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(width, 8, text(r.CafeName), "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(width, 6, text(r.Title), "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	if r.Invoice != "" {
+		pdf.CellFormat(width, 5, "Invoice "+text(r.Invoice), "", 1, "C", false, 0, "")
+	}
+	pdf.CellFormat(width, 5, r.IssuedAt.Format("2 Jan 2006 15:04"), "", 1, "C", false, 0, "")
+	pdf.Ln(3)
+
+	row := func(label, value string) {
+		pdf.CellFormat(width*0.65, 5, text(label), "", 0, "L", false, 0, "")
+		pdf.CellFormat(width*0.35, 5, text(value), "", 1, "R", false, 0, "")
+	}
+	rule := func() {
+		y := pdf.GetY() + 1
+		pdf.Line(12, y, 12+width, y)
+		pdf.Ln(2)
+	}
+
+	if r.Table != "" {
+		row("Table", r.Table)
+	}
+	if r.Customer != "" {
+		row("Customer", r.Customer)
+	}
+	if r.Staff != "" {
+		row("Served by", r.Staff)
+	}
+
+	if len(r.Lines) > 0 {
+		rule()
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(width*0.5, 6, "Item", "B", 0, "L", false, 0, "")
+		pdf.CellFormat(width*0.1, 6, "Qty", "B", 0, "R", false, 0, "")
+		pdf.CellFormat(width*0.2, 6, "Price", "B", 0, "R", false, 0, "")
+		pdf.CellFormat(width*0.2, 6, "Amount", "B", 1, "R", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		for _, l := range r.Lines {
+			pdf.CellFormat(width*0.5, 5, text(l.Name), "", 0, "L", false, 0, "")
+			pdf.CellFormat(width*0.1, 5, fmt.Sprint(l.Quantity), "", 0, "R", false, 0, "")
+			pdf.CellFormat(width*0.2, 5, l.Price.String(), "", 0, "R", false, 0, "")
+			pdf.CellFormat(width*0.2, 5, l.Amount.String(), "", 1, "R", false, 0, "")
+			if l.Discount != 0 {
+				pdf.CellFormat(width*0.8, 5, "   Discount", "", 0, "L", false, 0, "")
+				pdf.CellFormat(width*0.2, 5, "-"+l.Discount.String(), "", 1, "R", false, 0, "")
+			}
+		}
+	}
+
+	if r.HasBreakdown() {
+		rule()
+		row("Subtotal", amount(r.Subtotal))
+		if r.Discount != 0 {
+			row("Discount", "-"+amount(r.Discount))
+		}
+		if r.ServiceCharge != 0 {
+			row(fmt.Sprintf("Service charge %s%%", r.ServiceRate), amount(r.ServiceCharge))
+		}
+		for _, t := range r.Taxes {
+			label := fmt.Sprintf("%s %s%% on %s", t.Name, t.Rate, t.Taxable)
+			if r.TaxInclusive {
+				label += " (included)"
+			}
+			row(label, amount(t.Amount))
+		}
+		pdf.SetFont("Helvetica", "B", 11)
+		row("Total", amount(r.Total))
+		pdf.SetFont("Helvetica", "", 9)
+	}
+
+	if len(r.Payments) > 0 {
+		rule()
+		for _, p := range r.Payments {
+			row("Paid ("+p.Method+")", amount(p.Amount))
+		}
+	}
+	if r.Balance != nil {
+		pdf.SetFont("Helvetica", "B", 10)
+		row("Balance owed", amount(*r.Balance))
+		pdf.SetFont("Helvetica", "", 9)
+	}
+
+	if len(r.Notes) > 0 {
+		rule()
+		for _, n := range r.Notes {
+			pdf.MultiCell(width, 5, text(n), "", "L", false)
+		}
+	}
+
+	pdf.Ln(4)
+	pdf.CellFormat(width, 5, "Thank you!", "", 1, "C", false, 0, "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+// Package receipt renders customer receipts as PDF documents and as ESC/POS
+// byte streams for thermal printers.
+package receipt
+
+import (
+	"time"
+
+	"altia-cafe-backend/internal/models"
+)
+
+// Receipt is everything printed on a bill or payment slip. Amounts are
+// already worked out; rendering only lays them out.
+type Receipt struct {
+	CafeName string
+	Title    string // e.g. "TAX INVOICE" or "PAYMENT RECEIPT"
+	Invoice  string // empty when the document is not numbered
+	IssuedAt time.Time
+	Table    string
+	Customer string
+	Staff    string
+
+	Lines []Line
+
+	// Order breakdown; left zero on a payment slip without an order
+	Subtotal      models.Money
+	Discount      models.Money
+	ServiceCharge models.Money
+	ServiceRate   models.Percent
+	Taxes         []models.TaxLine
+	TaxInclusive  bool
+	Total         models.Money
+
+	Payments []Payment
+
+	// Balance is what the customer still owes on their account after this
+	// bill or payment; nil leaves it off, as on a bill split between
+	// customers
+	Balance *models.Money
+	Notes   []string
+}
+
+// Line is one item on the receipt.
+type Line struct {
+	Name     string
+	Quantity int
+	Price    models.Money
+	Discount models.Money
+	Amount   models.Money
+}
+
+// Payment is a payment listed on the receipt.
+type Payment struct {
+	Method string
+	Amount models.Money
+}
+
+// HasBreakdown reports whether the receipt lists an order.
+func (r Receipt) HasBreakdown() bool {
+	return len(r.Lines) > 0 || r.Total != 0
+}
+
+// Paid returns the sum of the payments on the receipt.
+func (r Receipt) Paid() models.Money {
+	var paid models.Money
+	for _, p := range r.Payments {
+		paid = paid.Add(p.Amount)
+	}
+	return paid
+}
+
+// Currency prefixes printed amounts. Thermal printers and the PDF core fonts
+// only cover Latin text, so the rupee is spelled out.
+const Currency = "Rs "
+
+func amount(m models.Money) string {
+	return Currency + m.String()
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
+	"time"
 
 	"altia-cafe-backend/internal/database"
 	"altia-cafe-backend/internal/handlers"
 	"altia-cafe-backend/internal/middleware"
+	"altia-cafe-backend/internal/models"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,6 +17,9 @@ import (
 )
 
 func main() {
+	assignOrphans := flag.Uint("assign-orphans", 0, "assign rows without a tenant to this cafe ID, then exit")
+	flag.Parse()
+
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
@@ -29,11 +35,26 @@ func main() {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// One-time migration: adopt legacy rows into a cafe
+	if *assignOrphans != 0 {
+		counts, err := database.AssignOrphans(*assignOrphans)
+		if err != nil {
+			log.Fatal("Failed to assign orphaned rows:", err)
+		}
+		for table, n := range counts {
+			log.Printf("Assigned %d %s rows to cafe %d", n, table, *assignOrphans)
+		}
+		return
+	}
+
 	// Seed database
 	if err := database.Seed(); err != nil {
 		log.Fatal("Failed to seed database:", err)
 	}
 
+	// Hold tables for upcoming reservations
+	go handlers.RunReservationSweeper(time.Minute)
+
 	// Set Gin mode
 	ginMode := os.Getenv("GIN_MODE")
 	if ginMode != "" {
@@ -42,79 +63,208 @@ func main() {
 
 	// Initialize Gin router
 	r := gin.Default()
-	r.Use(middleware.TenantMiddleware())
 
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Tenant", "X-Device-Token"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
 
+	// Resolve the cafe after CORS so rejected requests still carry CORS headers
+	r.Use(middleware.TenantMiddleware())
+
 	// Public routes
 	public := r.Group("/api")
 	{
 		public.POST("/auth/login", handlers.Login)
-		public.POST("/auth/signup", handlers.Signup)
+		public.POST("/auth/refresh", handlers.RefreshToken)
+		public.POST("/auth/pin", handlers.PINLogin)
+		public.GET("/auth/pin/users", handlers.GetTerminalUsers)
+		public.POST("/auth/invitations/accept", handlers.AcceptInvitation)
 	}
 
 	// Protected routes
 	protected := r.Group("/api")
 	protected.Use(middleware.AuthMiddleware())
 	{
-		// Cafes (platform admin)
-		protected.GET("/cafes", handlers.GetCafes)
-		protected.GET("/cafes/:id", handlers.GetCafe)
-		protected.POST("/cafes", handlers.CreateCafe)
-		protected.PUT("/cafes/:id", handlers.UpdateCafe)
-		protected.DELETE("/cafes/:id", handlers.DeleteCafe)
-
 		// Auth
 		protected.GET("/auth/me", handlers.GetMe)
+		protected.POST("/auth/logout", handlers.Logout)
+		protected.POST("/auth/password", handlers.ChangePassword)
+		protected.PUT("/auth/pin", handlers.SetPIN)
+	}
+
+	// Route groups are gated by the role permission matrix in models
+	can := middleware.RequirePermission
+
+	// Cafes (platform admin)
+	cafes := protected.Group("/cafes", can(models.PermCafeManage))
+	{
+		cafes.GET("", handlers.GetCafes)
+		cafes.GET("/:id", handlers.GetCafe)
+		cafes.POST("", handlers.CreateCafe)
+		cafes.PUT("/:id", handlers.UpdateCafe)
+		cafes.DELETE("/:id", handlers.DeleteCafe)
+	}
+
+	// Staff invitations
+	invitations := protected.Group("/invitations", can(models.PermUserManage))
+	{
+		invitations.GET("", handlers.GetInvitations)
+		invitations.POST("", handlers.CreateInvitation)
+		invitations.DELETE("/:id", handlers.RevokeInvitation)
+	}
+
+	// Staff accounts
+	users := protected.Group("/users", can(models.PermUserManage))
+	{
+		users.GET("", handlers.GetUsers)
+		users.GET("/:id", handlers.GetUser)
+		users.POST("", handlers.CreateUser)
+		users.PUT("/:id", handlers.UpdateUser)
+		users.DELETE("/:id", handlers.DeleteUser)
+		users.POST("/:id/reset-password", handlers.ResetUserPassword)
+		users.DELETE("/:id/sessions", handlers.RevokeUserSessions)
+	}
+
+	// Shared terminals
+	terminals := protected.Group("/terminals", can(models.PermTerminalManage))
+	{
+		terminals.GET("", handlers.GetTerminals)
+		terminals.POST("", handlers.CreateTerminal)
+		terminals.DELETE("/:id", handlers.DeleteTerminal)
+	}
+
+	// Menu Items
+	menu := protected.Group("/menu", can(models.PermMenuView))
+	{
+		menu.GET("", handlers.GetMenuItems)
+		menu.GET("/categories", handlers.GetMenuCategories)
+		menu.GET("/:id", handlers.GetMenuItem)
+		menu.POST("", can(models.PermMenuWrite), handlers.CreateMenuItem)
+		menu.PUT("/:id", can(models.PermMenuWrite), handlers.UpdateMenuItem)
+		menu.DELETE("/:id", can(models.PermMenuWrite), handlers.DeleteMenuItem)
+	}
+
+	// Reports and closing the business day
+	reports := protected.Group("/reports", can(models.PermReportsView))
+	{
+		reports.GET("/sales", handlers.GetSalesReport)
+		reports.GET("/payments", handlers.GetPaymentsReport)
+		reports.GET("/credit", handlers.GetCreditReport)
+		reports.GET("/top-items", handlers.GetTopItemsReport)
+		reports.GET("/hourly", handlers.GetHourlyReport)
+		reports.GET("/z", handlers.GetZReports)
+		reports.GET("/z/:date", handlers.GetZReport)
+		reports.POST("/z", can(models.PermReportsClose), handlers.CloseBusinessDay)
+	}
+
+	// Cash drawer sessions and shift reports
+	cash := protected.Group("/cash-sessions", can(models.PermCashDrawer))
+	{
+		cash.GET("", can(models.PermCashReconcile), handlers.GetCashSessions)
+		cash.GET("/current", handlers.GetCurrentCashSession)
+		cash.GET("/:id", handlers.GetCashSession)
+		cash.POST("", handlers.OpenCashSession)
+		cash.POST("/:id/movements", handlers.AddCashMovement)
+		cash.POST("/:id/close", handlers.CloseCashSession)
+		cash.GET("/:id/report", can(models.PermCashReconcile), handlers.GetCashSessionReport)
+	}
+
+	// Tax rates and service charge of the current cafe
+	tax := protected.Group("/tax", can(models.PermMenuView))
+	{
+		tax.GET("", handlers.GetTaxSettings)
+		tax.PUT("", can(models.PermTaxManage), handlers.UpdateTaxSettings)
+	}
+
+	// Tables
+	tables := protected.Group("/tables", can(models.PermTableView))
+	{
+		tables.GET("", handlers.GetTables)
+		tables.GET("/:id", handlers.GetTable)
+		tables.POST("", can(models.PermTableWrite), handlers.CreateTable)
+		tables.PUT("/:id", can(models.PermTableWrite), handlers.UpdateTable)
+		tables.DELETE("/:id", can(models.PermTableWrite), handlers.DeleteTable)
+		tables.POST("/:id/assign", can(models.PermTableServe), handlers.AssignCustomerToTable)
+		tables.GET("/:id/orders", can(models.PermOrderView), handlers.GetTableOrders)
+		tables.POST("/:id/payout", can(models.PermPaymentCreate), handlers.PayoutTable)
+		tables.POST("/:id/split", can(models.PermPaymentCreate), handlers.SplitTable)
+		tables.POST("/:id/transfer", can(models.PermTableServe), handlers.TransferTable)
+		tables.POST("/merge", can(models.PermTableServe), handlers.MergeTables)
+		tables.POST("/:id/unmerge", can(models.PermTableServe), handlers.UnmergeTable)
+	}
+
+	// Reservations
+	reservations := protected.Group("/reservations", can(models.PermTableView))
+	{
+		reservations.GET("", handlers.GetReservations)
+		reservations.GET("/availability", handlers.GetTableAvailability)
+		reservations.GET("/:id", handlers.GetReservation)
+		reservations.POST("", can(models.PermTableServe), handlers.CreateReservation)
+		reservations.PUT("/:id", can(models.PermTableServe), handlers.UpdateReservation)
+		reservations.POST("/:id/seat", can(models.PermTableServe), handlers.SeatReservation)
+		reservations.POST("/:id/cancel", can(models.PermTableServe), handlers.CancelReservation)
+		reservations.POST("/:id/no-show", can(models.PermTableServe), handlers.MarkReservationNoShow)
+	}
 
-		// Menu Items
-		protected.GET("/menu", handlers.GetMenuItems)
-		protected.GET("/menu/categories", handlers.GetMenuCategories)
-		protected.GET("/menu/:id", handlers.GetMenuItem)
-		protected.POST("/menu", handlers.CreateMenuItem)
-		protected.PUT("/menu/:id", handlers.UpdateMenuItem)
-		protected.DELETE("/menu/:id", handlers.DeleteMenuItem)
-
-		// Tables
-		protected.GET("/tables", handlers.GetTables)
-		protected.GET("/tables/:id", handlers.GetTable)
-		protected.POST("/tables", handlers.CreateTable)
-		protected.PUT("/tables/:id", handlers.UpdateTable)
-		protected.DELETE("/tables/:id", handlers.DeleteTable)
-		protected.POST("/tables/:id/assign", handlers.AssignCustomerToTable)
-		protected.GET("/tables/:id/orders", handlers.GetTableOrders)
-		protected.POST("/tables/:id/payout", handlers.PayoutTable)
-
-		// Customers
-		protected.GET("/customers", handlers.GetCustomers)
-		protected.GET("/customers/:id", handlers.GetCustomer)
-		protected.POST("/customers", handlers.CreateCustomer)
-		protected.PUT("/customers/:id", handlers.UpdateCustomer)
-		protected.DELETE("/customers/:id", handlers.DeleteCustomer)
-		protected.GET("/customers/:id/balance", handlers.GetCustomerBalance)
-
-		// Orders
-		protected.GET("/orders", handlers.GetOrders)
-		protected.GET("/orders/:id", handlers.GetOrder)
-		protected.POST("/orders", handlers.CreateOrder)
-		protected.PUT("/orders/:id", handlers.UpdateOrder)
-		protected.DELETE("/orders/:id", handlers.DeleteOrder)
-		protected.POST("/orders/:id/items", handlers.AddOrderItem)
-
-		// Payments
-		protected.GET("/payments", handlers.GetPayments)
-		protected.GET("/payments/:id", handlers.GetPayment)
-		protected.POST("/payments", handlers.CreatePayment)
-		protected.DELETE("/payments/:id", handlers.DeletePayment)
+	// Customers
+	customers := protected.Group("/customers", can(models.PermCustomerView))
+	{
+		customers.GET("", handlers.GetCustomers)
+		customers.GET("/:id", handlers.GetCustomer)
+		customers.POST("", can(models.PermCustomerWrite), handlers.CreateCustomer)
+		customers.PUT("/:id", can(models.PermCustomerWrite), handlers.UpdateCustomer)
+		customers.DELETE("/:id", can(models.PermCustomerDelete), handlers.DeleteCustomer)
+		customers.GET("/:id/balance", handlers.GetCustomerBalance)
+		customers.GET("/:id/ledger", handlers.GetCustomerLedger)
+		customers.POST("/:id/ledger", can(models.PermLedgerAdjust), handlers.AdjustCustomerLedger)
 	}
 
+	// Orders
+	orders := protected.Group("/orders", can(models.PermOrderView))
+	{
+		orders.GET("", handlers.GetOrders)
+		orders.GET("/:id", handlers.GetOrder)
+		orders.GET("/:id/receipt", handlers.GetOrderReceipt)
+		orders.POST("", can(models.PermOrderWrite), handlers.CreateOrder)
+		orders.PUT("/:id", can(models.PermOrderWrite), handlers.UpdateOrder)
+		orders.DELETE("/:id", can(models.PermOrderDelete), handlers.DeleteOrder)
+		orders.POST("/:id/items", can(models.PermOrderWrite), handlers.AddOrderItem)
+		orders.PUT("/:id/discount", can(models.PermDiscountApprove), handlers.SetOrderDiscount)
+		orders.PUT("/:id/items/:item_id/discount", can(models.PermDiscountApprove), handlers.SetOrderItemDiscount)
+	}
+
+	// Kitchen display
+	kds := protected.Group("/kds", can(models.PermKDSUse))
+	{
+		kds.GET("/:station", handlers.GetKDSQueue)
+		kds.POST("/:station/items/:id/bump", handlers.BumpKDSItem)
+		kds.POST("/:station/items/:id/recall", handlers.RecallKDSItem)
+	}
+
+	// Payments
+	payments := protected.Group("/payments", can(models.PermPaymentView))
+	{
+		payments.GET("", handlers.GetPayments)
+		payments.GET("/:id", handlers.GetPayment)
+		payments.GET("/:id/receipt", handlers.GetPaymentReceipt)
+		payments.POST("", can(models.PermPaymentCreate), handlers.CreatePayment)
+		payments.POST("/:id/refund", can(models.PermPaymentRefund), handlers.RefundPayment)
+	}
+
+	// Audit log
+	protected.GET("/audit", can(models.PermAuditView), handlers.GetAuditEvents)
+
+	// Live events; EventSource cannot send headers, so the stream is opened
+	// with a single-use ticket rather than the access token, which would
+	// otherwise be written to the request log with the URL
+	protected.POST("/events/ticket", handlers.CreateStreamTicket)
+	r.GET("/api/events", middleware.StreamTicketAuth(), handlers.StreamEvents)
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
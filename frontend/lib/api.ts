@@ -24,12 +24,45 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
-// Response interceptor: handle auth errors
+// Refresh the access token once; concurrent 401s share the same request
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = () => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem('refresh_token');
+    refreshing = (refreshToken
+      ? axios.post(`${API_URL}/auth/refresh`, { refresh_token: refreshToken }).then((res) => {
+          localStorage.setItem('token', res.data.token);
+          localStorage.setItem('refresh_token', res.data.refresh_token);
+          return res.data.token as string;
+        })
+      : Promise.reject(new Error('No refresh token'))
+    ).finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+};
+
+// Response interceptor: refresh expired tokens, otherwise send to login
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
     if (error.response?.status === 401 && typeof window !== 'undefined') {
+      if (original && !original._retried && !['/auth/login', '/auth/pin'].includes(original.url)) {
+        original._retried = true;
+        try {
+          const token = await refreshAccessToken();
+          original.headers = original.headers || {};
+          original.headers.Authorization = `Bearer ${token}`;
+          return api(original);
+        } catch {
+          // fall through to login
+        }
+      }
       localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
       localStorage.removeItem('user');
       window.location.href = '/login';
     }
@@ -40,9 +73,40 @@ api.interceptors.response.use(
 export const auth = {
   login: (username: string, password: string) =>
     api.post('/auth/login', { username, password }),
-  signup: (username: string, password: string, full_name: string, role?: string) =>
-    api.post('/auth/signup', { username, password, full_name, role }),
+  acceptInvitation: (token: string, username: string, password: string, full_name?: string) =>
+    api.post('/auth/invitations/accept', { token, username, password, full_name }),
   getMe: () => api.get('/auth/me'),
+  logout: () => api.post('/auth/logout'),
+  changePassword: (current_password: string, new_password: string) =>
+    api.post('/auth/password', { current_password, new_password }),
+  setPin: (pin: string, current_password: string) => api.put('/auth/pin', { pin, current_password }),
+  pinUsers: (device_token: string) =>
+    api.get('/auth/pin/users', { headers: { 'X-Device-Token': device_token } }),
+  pinLogin: (device_token: string, user_id: number, pin: string) =>
+    api.post('/auth/pin', { device_token, user_id, pin }),
+};
+
+export const terminals = {
+  getAll: () => api.get('/terminals'),
+  create: (name: string) => api.post('/terminals', { name }),
+  delete: (id: number) => api.delete(`/terminals/${id}`),
+};
+
+export const users = {
+  getAll: (params?: { role?: string; active?: boolean }) => api.get('/users', { params }),
+  getOne: (id: number) => api.get(`/users/${id}`),
+  create: (data: any) => api.post('/users', data),
+  update: (id: number, data: any) => api.put(`/users/${id}`, data),
+  delete: (id: number) => api.delete(`/users/${id}`),
+  resetPassword: (id: number, password: string) => api.post(`/users/${id}/reset-password`, { password }),
+  revokeSessions: (id: number) => api.delete(`/users/${id}/sessions`),
+};
+
+export const invitations = {
+  getAll: (status?: string) => api.get('/invitations', { params: { status } }),
+  create: (role: string, full_name?: string, expires_in_hours?: number) =>
+    api.post('/invitations', { role, full_name, expires_in_hours }),
+  revoke: (id: number) => api.delete(`/invitations/${id}`),
 };
 
 export const tables = {
@@ -56,6 +120,23 @@ export const tables = {
   getOrders: (id: number) => api.get(`/tables/${id}/orders`),
   payout: (id: number, amount: number, method: string, notes?: string) =>
     api.post(`/tables/${id}/payout`, { amount, method, notes }),
+  split: (id: number, data: { mode: 'item' | 'equal' | 'amount'; payers: any[]; notes?: string }) =>
+    api.post(`/tables/${id}/split`, data),
+  transfer: (id: number, to_table_id: number) => api.post(`/tables/${id}/transfer`, { to_table_id }),
+  merge: (table_ids: number[]) => api.post('/tables/merge', { table_ids }),
+  unmerge: (id: number) => api.post(`/tables/${id}/unmerge`),
+};
+
+export const reservations = {
+  getAll: (params?: any) => api.get('/reservations', { params }),
+  getOne: (id: number) => api.get(`/reservations/${id}`),
+  availability: (starts_at: string, ends_at: string, party_size?: number) =>
+    api.get('/reservations/availability', { params: { starts_at, ends_at, party_size } }),
+  create: (data: any) => api.post('/reservations', data),
+  update: (id: number, data: any) => api.put(`/reservations/${id}`, data),
+  seat: (id: number) => api.post(`/reservations/${id}/seat`),
+  cancel: (id: number) => api.post(`/reservations/${id}/cancel`),
+  noShow: (id: number) => api.post(`/reservations/${id}/no-show`),
 };
 
 export const customers = {
@@ -65,6 +146,8 @@ export const customers = {
   update: (id: number, data: any) => api.put(`/customers/${id}`, data),
   delete: (id: number) => api.delete(`/customers/${id}`),
   getBalance: (id: number) => api.get(`/customers/${id}/balance`),
+  adjustLedger: (id: number, data: { type: 'adjustment' | 'write_off'; amount: number; notes: string }) =>
+    api.post(`/customers/${id}/ledger`, data),
 };
 
 export const orders = {
@@ -74,13 +157,55 @@ export const orders = {
   update: (id: number, data: any) => api.put(`/orders/${id}`, data),
   delete: (id: number) => api.delete(`/orders/${id}`),
   addItem: (id: number, item: any) => api.post(`/orders/${id}/items`, item),
+  receipt: (id: number, format: 'pdf' | 'escpos' = 'pdf') =>
+    api.get(`/orders/${id}/receipt`, { params: { format }, responseType: 'blob' }),
+  discount: (id: number, data: { percent?: number; amount?: number; reason?: string }) =>
+    api.put(`/orders/${id}/discount`, data),
+  discountItem: (id: number, itemId: number, data: { percent?: number; amount?: number; reason?: string }) =>
+    api.put(`/orders/${id}/items/${itemId}/discount`, data),
+};
+
+export const reports = {
+  sales: (params?: { from?: string; to?: string }) => api.get('/reports/sales', { params }),
+  payments: (params?: { from?: string; to?: string }) => api.get('/reports/payments', { params }),
+  credit: (params?: { from?: string; to?: string }) => api.get('/reports/credit', { params }),
+  topItems: (params?: { from?: string; to?: string; limit?: number }) => api.get('/reports/top-items', { params }),
+  hourly: (params?: { from?: string; to?: string }) => api.get('/reports/hourly', { params }),
+  zReports: (params?: { from?: string; to?: string }) => api.get('/reports/z', { params }),
+  zReport: (date: string) => api.get(`/reports/z/${date}`),
+  closeDay: (date?: string) => api.post('/reports/z', date ? { date } : {}),
+};
+
+export const cashSessions = {
+  getAll: (params?: { status?: string; user_id?: number; terminal_id?: number; from?: string; to?: string }) =>
+    api.get('/cash-sessions', { params }),
+  getCurrent: () => api.get('/cash-sessions/current'),
+  getOne: (id: number) => api.get(`/cash-sessions/${id}`),
+  open: (data: { terminal_id?: number; opening_float: number; notes?: string }) => api.post('/cash-sessions', data),
+  move: (id: number, data: { type: 'cash_in' | 'cash_out'; amount: number; reason: string }) =>
+    api.post(`/cash-sessions/${id}/movements`, data),
+  close: (id: number, data: { counted: number; notes?: string }) => api.post(`/cash-sessions/${id}/close`, data),
+  report: (id: number) => api.get(`/cash-sessions/${id}/report`),
+};
+
+export const tax = {
+  get: () => api.get('/tax'),
+  update: (data: any) => api.put('/tax', data),
+};
+
+export const kds = {
+  getQueue: (station: string) => api.get(`/kds/${station}`),
+  bump: (station: string, itemId: number) => api.post(`/kds/${station}/items/${itemId}/bump`),
+  recall: (station: string, itemId: number) => api.post(`/kds/${station}/items/${itemId}/recall`),
 };
 
 export const payments = {
   getAll: (params?: any) => api.get('/payments', { params }),
   getOne: (id: number) => api.get(`/payments/${id}`),
   create: (data: any) => api.post('/payments', data),
-  delete: (id: number) => api.delete(`/payments/${id}`),
+  refund: (id: number, data: { amount?: number; reason: string }) => api.post(`/payments/${id}/refund`, data),
+  receipt: (id: number, format: 'pdf' | 'escpos' = 'pdf') =>
+    api.get(`/payments/${id}/receipt`, { params: { format }, responseType: 'blob' }),
 };
 
 export const menu = {
@@ -100,4 +225,15 @@ export const cafes = {
   delete: (id: number) => api.delete(`/cafes/${id}`),
 };
 
+// Opens the live event stream. EventSource cannot send headers, so the
+// stream is opened with a single-use ticket rather than the access token.
+export const openEventStream = async () => {
+  const { data } = await api.post('/events/ticket');
+  return new EventSource(`${API_URL}/events?ticket=${encodeURIComponent(data.ticket)}`);
+};
+
+export const audit = {
+  getAll: (params?: any) => api.get('/audit', { params }),
+};
+
 export default api;
@@ -1,7 +1,7 @@
 import Layout from '@/components/Layout';
 import StatCard from '@/components/StatCard';
 import { useEffect, useState } from 'react';
-import { tables, customers, orders, payments } from '@/lib/api';
+import { tables, customers, orders, payments, reports } from '@/lib/api';
 import {
   LayoutGrid,
   Users,
@@ -55,11 +55,15 @@ export default function Dashboard() {
       const totalRevenue = allOrders.filter((o: any) => o.status === 'billed').reduce((sum: number, o: any) => sum + o.total, 0);
       const outstandingCredit = allCustomers.reduce((sum: number, c: any) => sum + (c.credit_balance || 0), 0);
 
-      // Get today's revenue
+      // Today's revenue comes from the sales report; staff without access
+      // to reports fall back to adding up the orders
+      const salesRes = await reports.sales().catch(() => null);
       const today = new Date().toISOString().split('T')[0];
-      const todayRevenue = allOrders
-        .filter((o: any) => o.status === 'billed' && o.created_at?.startsWith(today))
-        .reduce((sum: number, o: any) => sum + o.total, 0);
+      const todayRevenue = salesRes
+        ? salesRes.data.totals.sales
+        : allOrders
+            .filter((o: any) => o.status === 'billed' && o.billed_at?.startsWith(today))
+            .reduce((sum: number, o: any) => sum + o.total, 0);
 
       setStats({
         totalTables: allTables.length,
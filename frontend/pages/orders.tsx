@@ -28,6 +28,12 @@ interface Order {
   customer_id: number;
   status: string;
   total: number;
+  subtotal?: number;
+  discount_total?: number;
+  service_charge?: number;
+  tax_total?: number;
+  tax_inclusive?: boolean;
+  taxes?: { name: string; rate: number; taxable: number; amount: number }[];
   notes: string;
   table?: { id: number; name: string };
   customer?: { id: number; name: string };
@@ -69,7 +75,7 @@ export default function Orders() {
   const [newOrder, setNewOrder] = useState({
     table_id: 0,
     customer_id: 0,
-    items: [] as { item_name: string; quantity: number; price: number }[],
+    items: [] as { menu_item_id: number; item_name: string; quantity: number; price: number }[],
   });
 
   useEffect(() => {
@@ -157,7 +163,7 @@ export default function Orders() {
   const handleUpdateStatus = async (id: number, currentStatus: string, newStatus: string) => {
     // Prevent accidental status changes
     if (currentStatus === 'billed') {
-      if (!confirm('This order is already billed. Are you sure you want to change its status?')) {
+      if (!confirm('This order is already billed. Voiding it reverses the charge to the customer. Continue?')) {
         return;
       }
     }
@@ -228,7 +234,7 @@ export default function Orders() {
   const addMenuItem = (item: MenuItem) => {
     setNewOrder({
       ...newOrder,
-      items: [...newOrder.items, { item_name: item.name, quantity: 1, price: item.price }],
+      items: [...newOrder.items, { menu_item_id: item.id, item_name: item.name, quantity: 1, price: item.price }],
     });
   };
 
@@ -252,10 +258,16 @@ export default function Orders() {
     switch (status) {
       case 'pending':
         return 'bg-yellow-100 text-yellow-800 border-yellow-300';
+      case 'preparing':
+      case 'ready':
+        return 'bg-orange-100 text-orange-800 border-orange-300';
       case 'served':
         return 'bg-blue-100 text-blue-800 border-blue-300';
       case 'billed':
         return 'bg-green-100 text-green-800 border-green-300';
+      case 'cancelled':
+      case 'void':
+        return 'bg-red-100 text-red-800 border-red-300';
       default:
         return 'bg-gray-100 text-gray-800 border-gray-300';
     }
@@ -465,8 +477,12 @@ export default function Orders() {
                             }`}
                         >
                           <option value="pending">Pending</option>
+                          <option value="preparing">Preparing</option>
+                          <option value="ready">Ready</option>
                           <option value="served">Served</option>
                           <option value="billed">Billed</option>
+                          <option value="cancelled">Cancelled</option>
+                          <option value="void">Void</option>
                         </select>
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap text-sm space-x-2">
@@ -882,6 +898,34 @@ export default function Orders() {
 
                 {/* Total */}
                 <div className="bg-gradient-to-br from-blue-50 to-blue-100 rounded-lg p-4 border-2 border-blue-200">
+                  {selectedOrder.subtotal !== undefined && (
+                    <div className="text-sm text-gray-700 space-y-1 mb-3">
+                      <div className="flex justify-between">
+                        <span>Subtotal</span>
+                        <span>रू {selectedOrder.subtotal.toFixed(2)}</span>
+                      </div>
+                      {!!selectedOrder.discount_total && (
+                        <div className="flex justify-between">
+                          <span>Discount</span>
+                          <span>- रू {selectedOrder.discount_total.toFixed(2)}</span>
+                        </div>
+                      )}
+                      {!!selectedOrder.service_charge && (
+                        <div className="flex justify-between">
+                          <span>Service charge</span>
+                          <span>रू {selectedOrder.service_charge.toFixed(2)}</span>
+                        </div>
+                      )}
+                      {selectedOrder.taxes?.map((tax) => (
+                        <div key={tax.name + tax.rate} className="flex justify-between">
+                          <span>
+                            {tax.name} {tax.rate}%{selectedOrder.tax_inclusive ? ' (incl.)' : ''}
+                          </span>
+                          <span>रू {tax.amount.toFixed(2)}</span>
+                        </div>
+                      ))}
+                    </div>
+                  )}
                   <div className="flex justify-between items-center">
                     <span className="text-lg font-semibold text-gray-900 flex items-center gap-2">
                       <DollarSign size={20} />
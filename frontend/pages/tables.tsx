@@ -637,7 +637,7 @@ export default function Tables() {
                         const payload = {
                           table_id: selectedTable.id,
                           customer_id: selectedTable.customer?.id || null,
-                          items: newOrderItems.map((i) => ({ item_id: i.item_id, quantity: i.quantity, price: i.price, item_name: i.item_name })),
+                          items: newOrderItems.map((i) => ({ menu_item_id: i.item_id, quantity: i.quantity })),
                         };
                         await orders.create(payload);
                         setShowOrderModal(false);